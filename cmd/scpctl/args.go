@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/scheme"
+)
+
+// readArgs reads StorageCapacityPrioritizationArgs of any served version
+// from the file, and converts it to the internal version. The defaults are
+// returned when the path is empty.
+func readArgs(path string) (*config.StorageCapacityPrioritizationArgs, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args, err := scheme.DecodeStorageCapacityPrioritizationArgs(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode args %q: %v", path, err)
+	}
+	return args, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	plugin "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/plugins/storagecapacityprioritization"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/snapshot"
+)
+
+func newCapacityReportCommand() *cobra.Command {
+	var kubeconfig, snapshotPath, argsPath, request, output string
+	command := &cobra.Command{
+		Use:   "capacity-report",
+		Short: "Print the capacity of every storage class on every node",
+		Long: `Capacity-report prints the capacity of every storage class whose CSI driver
+publishes the capacity on every node: the CSIStorageCapacity objects matching
+the node, the capacity, the MaximumVolumeSize, the demand of the pending claims
+being provisioned on the node, and whether a claim of the requested size passes
+Filter with the usage ratio and the score which PreScore calculates.
+
+The objects are read from the cluster of the kubeconfig, or from a snapshot.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			args, err := readArgs(argsPath)
+			if err != nil {
+				return err
+			}
+			size, err := resource.ParseQuantity(request)
+			if err != nil {
+				return fmt.Errorf("invalid request %q: %v", request, err)
+			}
+			objects, err := loadObjects(cmd.Context(), kubeconfig, snapshotPath)
+			if err != nil {
+				return err
+			}
+			reports, err := plugin.ReportCapacities(cmd.Context(), args, objects, size.Value())
+			if err != nil {
+				return err
+			}
+			return printCapacityReports(cmd.OutOrStdout(), reports, output)
+		},
+	}
+	flags := command.Flags()
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file. The default loading rules of kubectl are used when it's not set")
+	flags.StringVarP(&snapshotPath, "snapshot", "f", "", "path to the snapshot archive or manifests of the cluster. The cluster of the kubeconfig is read when it's not set")
+	flags.StringVar(&argsPath, "args", "", "path to the StorageCapacityPrioritizationArgs file. The defaults are used when it's not set")
+	flags.StringVar(&request, "request", "1Gi", "size of the hypothetical claim the usage ratio and the score are calculated for")
+	flags.StringVarP(&output, "output", "o", "table", "output format: table, json or csv")
+	return command
+}
+
+// loadObjects reads the objects from the snapshot file when it's set, and
+// from the cluster of the kubeconfig otherwise.
+func loadObjects(ctx context.Context, kubeconfig, snapshotPath string) ([]runtime.Object, error) {
+	if snapshotPath != "" {
+		return snapshot.LoadObjects(snapshotPath)
+	}
+	client, dynamicClient, err := newClients(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := snapshot.Record(ctx, client, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Objects(), nil
+}
+
+func formatBytes(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
+
+func printCapacityReports(w io.Writer, reports []*plugin.CapacityReport, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"node", "storageClass", "capacity", "available", "maximumVolumeSize", "pendingDemand", "feasible", "usage", "score", "csiStorageCapacities"})
+		for _, r := range reports {
+			cw.Write([]string{
+				r.Node,
+				r.StorageClass,
+				strconv.FormatInt(r.Capacity, 10),
+				strconv.FormatInt(r.Available, 10),
+				strconv.FormatInt(r.MaximumVolumeSize, 10),
+				strconv.FormatInt(r.PendingDemand, 10),
+				strconv.FormatBool(r.Feasible),
+				strconv.FormatFloat(r.Usage, 'f', -1, 64),
+				strconv.FormatFloat(r.Score, 'f', -1, 64),
+				strings.Join(r.CSIStorageCapacities, " "),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODE\tSTORAGECLASS\tCAPACITY\tAVAILABLE\tMAXVOLUMESIZE\tPENDING\tFEASIBLE\tUSAGE\tSCORE\tCSISTORAGECAPACITIES")
+		for _, r := range reports {
+			maximumVolumeSize := "-"
+			if r.MaximumVolumeSize > 0 {
+				maximumVolumeSize = formatBytes(r.MaximumVolumeSize)
+			}
+			capacities := "<none>"
+			if len(r.CSIStorageCapacities) > 0 {
+				capacities = strings.Join(r.CSIStorageCapacities, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%.2f\t%.1f\t%s\n",
+				r.Node, r.StorageClass, formatBytes(r.Capacity), formatBytes(r.Available), maximumVolumeSize,
+				formatBytes(r.PendingDemand), r.Feasible, r.Usage, r.Score, capacities)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unsupported output format %q", output)
+}
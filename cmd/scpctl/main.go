@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	command := &cobra.Command{
+		Use:          "scpctl",
+		Short:        "Tools for the storage capacity prioritization scheduler",
+		SilenceUsage: true,
+	}
+	command.AddCommand(
+		newSimulateCommand(),
+		newSnapshotCommand(),
+		newCapacityReportCommand(),
+	)
+	if err := command.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	plugin "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/plugins/storagecapacityprioritization"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/snapshot"
+)
+
+func newSimulateCommand() *cobra.Command {
+	var snapshotPath, argsPath, podName, output string
+	command := &cobra.Command{
+		Use:   "simulate",
+		Short: "Simulate the placement of a pod against a snapshot of a cluster",
+		Long: `Simulate runs Filter and Score of the StorageCapacityPrioritization plugin
+for a pod against the objects in a snapshot file, and prints whether every
+node passes Filter with the reasons, and the scores of the feasible nodes.
+
+The snapshot is an archive recorded by "scpctl snapshot", or a YAML or JSON
+file of the Nodes, StorageClasses, CSIDrivers, CSIStorageCapacities,
+PersistentVolumeClaims, PersistentVolumes and Pods.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			args, err := readArgs(argsPath)
+			if err != nil {
+				return err
+			}
+			objects, err := snapshot.LoadObjects(snapshotPath)
+			if err != nil {
+				return err
+			}
+			pod, err := findPod(objects, podName)
+			if err != nil {
+				return err
+			}
+			results, err := plugin.Simulate(cmd.Context(), args, objects, pod)
+			if err != nil {
+				return err
+			}
+			return printSimulation(cmd.OutOrStdout(), results, output)
+		},
+	}
+	flags := command.Flags()
+	flags.StringVarP(&snapshotPath, "snapshot", "f", "", "path to the snapshot archive or manifests of the cluster")
+	flags.StringVar(&argsPath, "args", "", "path to the StorageCapacityPrioritizationArgs file. The defaults are used when it's not set")
+	flags.StringVar(&podName, "pod", "", "namespace/name of the pod to place. It can be omitted when the snapshot has only one unscheduled pod")
+	flags.StringVarP(&output, "output", "o", "table", "output format: table or json")
+	command.MarkFlagRequired("snapshot")
+	return command
+}
+
+// findPod finds the pod of the name from the objects. When the name is empty,
+// it finds the only pod which is not scheduled yet.
+func findPod(objects []runtime.Object, name string) (*v1.Pod, error) {
+	namespace := v1.NamespaceDefault
+	if i := strings.Index(name, "/"); i >= 0 {
+		namespace, name = name[:i], name[i+1:]
+	}
+	var found *v1.Pod
+	for _, obj := range objects {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		if name != "" {
+			if pod.Namespace == namespace && pod.Name == name {
+				return pod, nil
+			}
+			continue
+		}
+		if pod.Spec.NodeName != "" {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("more than one unscheduled pod found, specify one with --pod")
+		}
+		found = pod
+	}
+	if found == nil {
+		return nil, fmt.Errorf("pod to place is not found")
+	}
+	return found, nil
+}
+
+func printSimulation(w io.Writer, results []*plugin.NodeSimulation, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODE\tFEASIBLE\tSCORE\tREASONS")
+		for _, result := range results {
+			score := "-"
+			if result.Score != nil {
+				score = fmt.Sprint(*result.Score)
+			}
+			fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", result.Node, result.Feasible, score, strings.Join(result.Reasons, "; "))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unsupported output format %q", output)
+}
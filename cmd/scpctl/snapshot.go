@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/snapshot"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	var kubeconfig, output string
+	command := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Record the objects which the plugin reads from a cluster into an archive",
+		Long: `Snapshot records the Nodes, StorageClasses, CSIDrivers, CSIStorageCapacities,
+PersistentVolumes, the Pods, and the PersistentVolumeClaims which are pending or
+referenced by the Pods of a cluster into a single archive file, which
+"scpctl simulate" reads.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, dynamicClient, err := newClients(kubeconfig)
+			if err != nil {
+				return err
+			}
+			archive, err := snapshot.Record(cmd.Context(), client, dynamicClient)
+			if err != nil {
+				return err
+			}
+			var w io.Writer = cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			return snapshot.Write(w, archive)
+		},
+	}
+	flags := command.Flags()
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file. The default loading rules of kubectl are used when it's not set")
+	flags.StringVarP(&output, "output", "o", "", "path to the archive file to write. The archive is written to the standard output when it's not set")
+	return command
+}
+
+// newClients returns the clients of the cluster of the kubeconfig.
+func newClients(kubeconfig string) (kubernetes.Interface, dynamic.Interface, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, dynamicClient, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/logs"
+	"k8s.io/klog/v2"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/scheme"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/extender"
+)
+
+func main() {
+	var kubeconfig, argsPath, listenAddress string
+	pflag.CommandLine.SetNormalizeFunc(cliflag.WordSepNormalizeFunc)
+	pflag.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file. The in-cluster config is used when it's not set")
+	pflag.StringVar(&argsPath, "args", "", "path to the StorageCapacityPrioritizationArgs file. The defaults are used when it's not set")
+	pflag.StringVar(&listenAddress, "listen-address", ":8888", "address the extender listens on")
+	logs.AddFlags(pflag.CommandLine)
+	pflag.Parse()
+
+	logs.InitLogs()
+	defer logs.FlushLogs()
+
+	if err := run(kubeconfig, argsPath, listenAddress); err != nil {
+		klog.ErrorS(err, "Failed to run the extender")
+		os.Exit(1)
+	}
+}
+
+func run(kubeconfig, argsPath, listenAddress string) error {
+	var data []byte
+	if argsPath != "" {
+		var err error
+		data, err = os.ReadFile(argsPath)
+		if err != nil {
+			return err
+		}
+	}
+	args, err := scheme.DecodeStorageCapacityPrioritizationArgs(data)
+	if err != nil {
+		return err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	fh, err := frameworkruntime.NewFramework(nil, nil,
+		frameworkruntime.WithClientSet(client),
+		frameworkruntime.WithKubeConfig(config),
+		frameworkruntime.WithInformerFactory(informerFactory),
+	)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ext, err := extender.New(ctx, args, fh)
+	if err != nil {
+		return err
+	}
+
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	klog.InfoS("Starting the extender", "address", listenAddress)
+	return http.ListenAndServe(listenAddress, ext.Handler())
+}
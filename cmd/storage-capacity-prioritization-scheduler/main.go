@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"math/rand"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -14,14 +17,18 @@ import (
 	_ "k8s.io/component-base/metrics/prometheus/version" // for version metric registration
 	"k8s.io/kubernetes/cmd/kube-scheduler/app"
 
+	_ "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/scheme" // for StorageCapacityPrioritizationArgs registration
 	plugin "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/plugins/storagecapacityprioritization"
 )
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 	pflag.CommandLine.SetNormalizeFunc(cliflag.WordSepNormalizeFunc)
+	// The informers started by the plugin are stopped with the scheduler.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	command := app.NewSchedulerCommand(
-		app.WithPlugin(plugin.Name, plugin.New),
+		app.WithPlugin(plugin.Name, plugin.NewFactory(ctx)),
 	)
 
 	logs.InitLogs()
@@ -7,7 +7,7 @@ import (
 )
 
 // GroupName is the group name used in this package
-const GroupName = "kubescheduler.bells17.io"
+const GroupName = "kubescheduler.config.k8s.io"
 
 // SchemeGroupVersion is group version used to register these objects
 var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: runtime.APIVersionInternal}
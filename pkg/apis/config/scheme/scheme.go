@@ -1,12 +1,16 @@
 package scheme
 
 import (
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	kubeschedulerscheme "k8s.io/kubernetes/pkg/scheduler/apis/config/scheme"
 
 	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/v1beta2"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/v1beta3"
 )
 
 var (
@@ -24,4 +28,31 @@ func init() {
 // AddToScheme builds the kubescheduler scheme using all known versions of the kubescheduler api.
 func AddToScheme(scheme *runtime.Scheme) {
 	utilruntime.Must(config.AddToScheme(scheme))
+	utilruntime.Must(v1beta2.AddToScheme(scheme))
+	utilruntime.Must(v1beta3.AddToScheme(scheme))
+	utilruntime.Must(scheme.SetVersionPriority(v1beta3.SchemeGroupVersion, v1beta2.SchemeGroupVersion))
+}
+
+// defaultArgs is decoded when no args are given, so that the defaults of the
+// latest version are applied.
+const defaultArgs = `apiVersion: kubescheduler.config.k8s.io/v1beta3
+kind: StorageCapacityPrioritizationArgs
+`
+
+// DecodeStorageCapacityPrioritizationArgs decodes StorageCapacityPrioritizationArgs
+// of any served version, applying the defaults, into the internal version.
+// The defaults of the latest version are returned when data is empty.
+func DecodeStorageCapacityPrioritizationArgs(data []byte) (*config.StorageCapacityPrioritizationArgs, error) {
+	if len(data) == 0 {
+		data = []byte(defaultArgs)
+	}
+	obj, _, err := Codecs.UniversalDecoder().Decode(data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	args, ok := obj.(*config.StorageCapacityPrioritizationArgs)
+	if !ok {
+		return nil, fmt.Errorf("want args to be of type StorageCapacityPrioritizationArgs, got %T", obj)
+	}
+	return args, nil
 }
@@ -0,0 +1,165 @@
+package scheme
+
+import (
+	"reflect"
+	"testing"
+
+	schedconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
+	"k8s.io/utils/pointer"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+func TestCodecsDecodePluginConfig(t *testing.T) {
+	table := []struct {
+		name       string
+		data       []byte
+		wantErr    bool
+		expectArgs *config.StorageCapacityPrioritizationArgs
+	}{
+		{
+			name: "v1beta3 with args",
+			data: []byte(`
+apiVersion: kubescheduler.config.k8s.io/v1beta3
+kind: KubeSchedulerConfiguration
+profiles:
+- schedulerName: storage-capacity-prioritization-scheduler
+  plugins:
+    filter:
+      enabled:
+      - name: StorageCapacityPrioritization
+  pluginConfig:
+  - name: StorageCapacityPrioritization
+    args:
+      scoringStrategy:
+        type: RequestedToCapacityRatio
+      storageClasses:
+      - storageClassName: fast
+        weight: 10
+        scoringStrategy:
+          type: LeastAllocated
+      - provisioner: topolvm.cybozu.com
+`),
+			expectArgs: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.RequestedToCapacityRatio,
+					RequestedToCapacityRatio: &config.RequestedToCapacityRatioParam{
+						Shape: []config.UtilizationShapePoint{
+							{Utilization: 0, Score: 0},
+							{Utilization: 100, Score: 10},
+						},
+					},
+				},
+				StorageClasses: []config.StorageClassPolicy{
+					{
+						StorageClassName: "fast",
+						Weight:           pointer.Int32Ptr(10),
+						ScoringStrategy:  &config.ScoringStrategy{Type: config.LeastAllocated},
+					},
+					{
+						Provisioner:     "topolvm.cybozu.com",
+						Weight:          pointer.Int32Ptr(1),
+						ScoringStrategy: nil,
+					},
+				},
+				CapacityAggregation: config.PackCapacityAggregation,
+				ScoreNormalization:  config.NoneScoreNormalization,
+				UnknownCapacity:     config.RejectUnknownCapacity,
+			},
+		},
+		{
+			name: "v1beta2 defaults",
+			data: []byte(`
+apiVersion: kubescheduler.config.k8s.io/v1beta2
+kind: KubeSchedulerConfiguration
+profiles:
+- schedulerName: storage-capacity-prioritization-scheduler
+  plugins:
+    filter:
+      enabled:
+      - name: StorageCapacityPrioritization
+`),
+			expectArgs: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.MostAllocated,
+				},
+				CapacityAggregation: config.PackCapacityAggregation,
+				ScoreNormalization:  config.NoneScoreNormalization,
+				UnknownCapacity:     config.RejectUnknownCapacity,
+			},
+		},
+		{
+			name: "v1beta2 with zero weight",
+			data: []byte(`
+apiVersion: kubescheduler.config.k8s.io/v1beta2
+kind: KubeSchedulerConfiguration
+profiles:
+- schedulerName: storage-capacity-prioritization-scheduler
+  pluginConfig:
+  - name: StorageCapacityPrioritization
+    args:
+      storageClasses:
+      - storageClassName: slow
+        weight: 0
+`),
+			expectArgs: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.MostAllocated,
+				},
+				StorageClasses: []config.StorageClassPolicy{
+					{
+						StorageClassName: "slow",
+						Weight:           pointer.Int32Ptr(0),
+					},
+				},
+				CapacityAggregation: config.PackCapacityAggregation,
+				ScoreNormalization:  config.NoneScoreNormalization,
+				UnknownCapacity:     config.RejectUnknownCapacity,
+			},
+		},
+		{
+			name: "v1beta3 with unknown field",
+			data: []byte(`
+apiVersion: kubescheduler.config.k8s.io/v1beta3
+kind: KubeSchedulerConfiguration
+profiles:
+- schedulerName: storage-capacity-prioritization-scheduler
+  pluginConfig:
+  - name: StorageCapacityPrioritization
+    args:
+      unknown: true
+`),
+			wantErr: true,
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			obj, _, err := Codecs.UniversalDecoder().Decode(item.data, nil, nil)
+			if item.wantErr {
+				if err == nil {
+					t.Fatal("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, ok := obj.(*schedconfig.KubeSchedulerConfiguration)
+			if !ok {
+				t.Fatalf("decoded object is not KubeSchedulerConfiguration: %T", obj)
+			}
+			var args *config.StorageCapacityPrioritizationArgs
+			for _, pc := range cfg.Profiles[0].PluginConfig {
+				if pc.Name == "StorageCapacityPrioritization" {
+					args, ok = pc.Args.(*config.StorageCapacityPrioritizationArgs)
+					if !ok {
+						t.Fatalf("args is not StorageCapacityPrioritizationArgs: %T", pc.Args)
+					}
+				}
+			}
+			if !reflect.DeepEqual(args, item.expectArgs) {
+				t.Errorf("args does not match got: %+v, want: %+v", args, item.expectArgs)
+			}
+		})
+	}
+}
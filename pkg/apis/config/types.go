@@ -1,11 +1,173 @@
 package config
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// StorageCapacityPrioritizationArgs holds arguments used to configure the StorageCapacityPrioritization plugin.
 type StorageCapacityPrioritizationArgs struct {
 	metav1.TypeMeta `json:",inline"`
+
+	// ScoringStrategy selects the storage capacity scoring strategy.
+	// MostAllocated is used when it is not set.
+	ScoringStrategy *ScoringStrategy `json:"scoringStrategy,omitempty"`
+
+	// StorageClasses holds the settings applied to specific storage classes.
+	// A storage class which is not matched by any entry has the weight 1
+	// and is scored with ScoringStrategy.
+	StorageClasses []StorageClassPolicy `json:"storageClasses,omitempty"`
+
+	// CapacityAggregation selects how the CSIStorageCapacity objects of a
+	// storage class which match a node are aggregated.
+	// Pack is used when it is not set.
+	CapacityAggregation CapacityAggregationType `json:"capacityAggregation,omitempty"`
+
+	// ConsiderMaximumVolumeSize makes the scorers take the ratio of the largest
+	// claim to the MaximumVolumeSize of the CSIStorageCapacity objects into account
+	// when it's higher than the ratio of the requested bytes to the capacity.
+	ConsiderMaximumVolumeSize bool `json:"considerMaximumVolumeSize,omitempty"`
+
+	// ScoreNormalization selects how the scores are rescaled across the
+	// candidate nodes to the range of the node score.
+	// None is used when it is not set.
+	ScoreNormalization ScoreNormalizationType `json:"scoreNormalization,omitempty"`
+
+	// UnknownCapacity selects how the nodes are treated when the CSI driver of
+	// the storage class publishes the capacity but no CSIStorageCapacity object
+	// covers the node.
+	// Reject is used when it is not set.
+	UnknownCapacity UnknownCapacityPolicy `json:"unknownCapacity,omitempty"`
+
+	// ScoreExplanationNodes is the number of the top scored nodes whose scores
+	// are recorded on the pod as an annotation when the pod is bound.
+	// The scores are not recorded when it is 0.
+	ScoreExplanationNodes int32 `json:"scoreExplanationNodes,omitempty"`
+
+	// EnablePreemption enables the preemption of the lower priority pods whose
+	// generic ephemeral volumes free enough capacity for the claims, when no
+	// node has enough capacity.
+	EnablePreemption bool `json:"enablePreemption,omitempty"`
+}
+
+// ScoreNormalizationType the type of the normalization of the scores across the candidate nodes.
+type ScoreNormalizationType string
+
+const (
+	// NoneScoreNormalization uses the scores as they are.
+	NoneScoreNormalization ScoreNormalizationType = "None"
+	// MinMaxScoreNormalization rescales the scores linearly so that the lowest
+	// score becomes 0 and the highest score becomes the max node score.
+	MinMaxScoreNormalization ScoreNormalizationType = "MinMax"
+	// RankScoreNormalization replaces the scores with their ranks spread evenly
+	// between 0 and the max node score.
+	RankScoreNormalization ScoreNormalizationType = "Rank"
+)
+
+// UnknownCapacityPolicy the type of the treatment of the nodes whose capacity is unknown.
+type UnknownCapacityPolicy string
+
+const (
+	// NeutralUnknownCapacity passes the nodes and gives them the midpoint of the node score.
+	NeutralUnknownCapacity UnknownCapacityPolicy = "Neutral"
+	// ZeroUnknownCapacity passes the nodes and gives them the score of 0.
+	ZeroUnknownCapacity UnknownCapacityPolicy = "Zero"
+	// MaxUnknownCapacity passes the nodes and gives them the max node score.
+	MaxUnknownCapacity UnknownCapacityPolicy = "Max"
+	// RejectUnknownCapacity filters out the nodes.
+	RejectUnknownCapacity UnknownCapacityPolicy = "Reject"
+)
+
+// CapacityAggregationType the type of the aggregation of the CSIStorageCapacity objects
+// of a storage class which match a node.
+type CapacityAggregationType string
+
+const (
+	// MaxCapacityAggregation uses the CSIStorageCapacity object with the largest capacity.
+	MaxCapacityAggregation CapacityAggregationType = "Max"
+	// SumCapacityAggregation uses the sum of the capacities of the CSIStorageCapacity objects
+	// whose MaximumVolumeSize allows the largest claim.
+	SumCapacityAggregation CapacityAggregationType = "Sum"
+	// BestFitCapacityAggregation uses the CSIStorageCapacity object with the smallest capacity
+	// which is enough for the claims.
+	BestFitCapacityAggregation CapacityAggregationType = "BestFit"
+	// PackCapacityAggregation packs the claims one by one into the CSIStorageCapacity objects
+	// in first-fit decreasing order, so that every claim fits in a single object.
+	PackCapacityAggregation CapacityAggregationType = "Pack"
+)
+
+// StorageClassPolicy holds the settings applied to the storage classes
+// matched by StorageClassName or Provisioner.
+// An entry matched by StorageClassName takes precedence over the one matched by Provisioner.
+type StorageClassPolicy struct {
+	// StorageClassName is the name of the storage class this policy is applied to.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// Provisioner is the provisioner of the storage classes this policy is applied to.
+	// Only one of StorageClassName and Provisioner can be specified.
+	Provisioner string `json:"provisioner,omitempty"`
+	// Weight of the storage class used when the scores of the storage classes
+	// of a pod are combined into the node score. Valid values are 0 to 100,
+	// and 0 takes the storage class out of the node score. The weight 1 is
+	// used when it is not set.
+	Weight *int32 `json:"weight,omitempty"`
+	// ScoringStrategy overrides the plugin wide scoring strategy for the storage class.
+	ScoringStrategy *ScoringStrategy `json:"scoringStrategy,omitempty"`
+	// ReservedCapacity is the capacity kept unused in every CSIStorageCapacity
+	// object of the storage class.
+	ReservedCapacity *resource.Quantity `json:"reservedCapacity,omitempty"`
+	// ReservedCapacityPercentage is the percentage of the capacity kept unused
+	// in every CSIStorageCapacity object of the storage class. Valid values are 0 to 100.
+	// The larger one is reserved when both ReservedCapacity and ReservedCapacityPercentage are set.
+	ReservedCapacityPercentage int32 `json:"reservedCapacityPercentage,omitempty"`
+	// OvercommitPercentage is the percentage of the capacity of every
+	// CSIStorageCapacity object of the storage class which can be provisioned,
+	// for thin provisioned storage. e.g. 200 allows twice the capacity.
+	// Valid values are 0 and 100 or more, and 0 means no overcommit.
+	OvercommitPercentage int32 `json:"overcommitPercentage,omitempty"`
+	// MaxUsedCapacityPercentage is the hard ceiling of the data actually
+	// written to the pool of every CSIStorageCapacity object of the storage
+	// class, in percentage of the size of the pool: the published capacity
+	// and the used capacity annotated on the object. Nothing is provisioned
+	// from the object once the used capacity reaches it, so that overcommitted
+	// thin pools are not filled up. Valid values are 0 to 100, and 0 means no
+	// ceiling. The objects without the used capacity annotation are not limited.
+	MaxUsedCapacityPercentage int32 `json:"maxUsedCapacityPercentage,omitempty"`
+}
+
+// ScoringStrategyType the type of scoring strategy used in StorageCapacityPrioritization plugin.
+type ScoringStrategyType string
+
+const (
+	// LeastAllocated strategy prioritizes nodes with the most free storage capacity.
+	LeastAllocated ScoringStrategyType = "LeastAllocated"
+	// MostAllocated strategy prioritizes nodes with the least free storage capacity.
+	MostAllocated ScoringStrategyType = "MostAllocated"
+	// RequestedToCapacityRatio strategy allows specifying a custom shape function
+	// to score nodes based on the request to capacity ratio.
+	RequestedToCapacityRatio ScoringStrategyType = "RequestedToCapacityRatio"
+)
+
+// ScoringStrategy define ScoringStrategyType for StorageCapacityPrioritization plugin.
+type ScoringStrategy struct {
+	// Type selects which strategy to run.
+	Type ScoringStrategyType `json:"type,omitempty"`
+
+	// Arguments specific to RequestedToCapacityRatio strategy.
+	RequestedToCapacityRatio *RequestedToCapacityRatioParam `json:"requestedToCapacityRatio,omitempty"`
+}
+
+// RequestedToCapacityRatioParam define RequestedToCapacityRatio parameters.
+type RequestedToCapacityRatioParam struct {
+	// Shape is a list of points defining the scoring function shape.
+	Shape []UtilizationShapePoint `json:"shape,omitempty"`
+}
+
+// UtilizationShapePoint represents a single point of a priority function shape.
+type UtilizationShapePoint struct {
+	// Utilization (x axis). Valid values are 0 to 100. Fully utilized storage capacity maps to 100.
+	Utilization int32 `json:"utilization"`
+	// Score assigned to a given utilization (y axis). Valid values are 0 to 10.
+	Score int32 `json:"score"`
 }
@@ -0,0 +1,53 @@
+package v1beta3
+
+import (
+	"k8s.io/utils/pointer"
+)
+
+var defaultShape = []UtilizationShapePoint{
+	{Utilization: 0, Score: 0},
+	{Utilization: 100, Score: 10},
+}
+
+// SetDefaults_StorageCapacityPrioritizationArgs sets the default parameters for the StorageCapacityPrioritization plugin.
+func SetDefaults_StorageCapacityPrioritizationArgs(obj *StorageCapacityPrioritizationArgs) {
+	if obj.ScoringStrategy == nil {
+		obj.ScoringStrategy = &ScoringStrategy{}
+	}
+	setDefaults_ScoringStrategy(obj.ScoringStrategy)
+
+	if obj.CapacityAggregation == "" {
+		obj.CapacityAggregation = PackCapacityAggregation
+	}
+
+	if obj.ScoreNormalization == "" {
+		obj.ScoreNormalization = NoneScoreNormalization
+	}
+
+	if obj.UnknownCapacity == "" {
+		obj.UnknownCapacity = RejectUnknownCapacity
+	}
+
+	for i := range obj.StorageClasses {
+		policy := &obj.StorageClasses[i]
+		if policy.Weight == nil {
+			policy.Weight = pointer.Int32Ptr(1)
+		}
+		if policy.ScoringStrategy != nil {
+			setDefaults_ScoringStrategy(policy.ScoringStrategy)
+		}
+	}
+}
+
+func setDefaults_ScoringStrategy(obj *ScoringStrategy) {
+	if obj.Type == "" {
+		obj.Type = MostAllocated
+	}
+	if obj.Type == RequestedToCapacityRatio && obj.RequestedToCapacityRatio == nil {
+		shape := make([]UtilizationShapePoint, len(defaultShape))
+		copy(shape, defaultShape)
+		obj.RequestedToCapacityRatio = &RequestedToCapacityRatioParam{
+			Shape: shape,
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// +k8s:deepcopy-gen=package
+// +k8s:conversion-gen=github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=kubescheduler.config.k8s.io
+
+// Package v1beta3 is the v1beta3 version of the StorageCapacityPrioritization plugin args.
+package v1beta3 // import "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config/v1beta3"
@@ -0,0 +1,247 @@
+// Package extender serves the filter and the scoring of the
+// StorageCapacityPrioritization plugin as a kube-scheduler extender, for the
+// clusters where kube-scheduler can't be replaced.
+package extender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	plugin "github.com/bells17/storage-capacity-prioritization-scheduler/pkg/plugins/storagecapacityprioritization"
+)
+
+// scoringPlugin is the extension points of the plugin which the extender runs.
+type scoringPlugin interface {
+	framework.PreFilterPlugin
+	framework.FilterPlugin
+	framework.PreScorePlugin
+	framework.ScorePlugin
+}
+
+// Extender runs PreFilter, Filter, PreScore and Score of the plugin for the
+// filter and the prioritize verbs of the scheduler extender. The plugin finds
+// the claims of the pod by itself, so it doesn't depend on the state of the
+// VolumeBinding plugin of the scheduler.
+// The capacity is not assumed for the pods being bound because the extender
+// has no Reserve extension point.
+type Extender struct {
+	plugin     scoringPlugin
+	nodeLister corelisters.NodeLister
+}
+
+// New returns the extender running the plugin with the args. The informers
+// of the shared informer factory of the handle have to be started after it.
+// The informers started by the plugin are stopped when the context is canceled.
+func New(ctx context.Context, args *config.StorageCapacityPrioritizationArgs, handle framework.Handle) (*Extender, error) {
+	p, err := plugin.NewFactory(ctx)(args, handle)
+	if err != nil {
+		return nil, err
+	}
+	pl, ok := p.(scoringPlugin)
+	if !ok {
+		return nil, fmt.Errorf("plugin %q doesn't implement the extension points of the extender", p.Name())
+	}
+	return &Extender{
+		plugin:     pl,
+		nodeLister: handle.SharedInformerFactory().Core().V1().Nodes().Lister(),
+	}, nil
+}
+
+// nodesOf returns the nodes of the args. When the scheduler caches the nodes,
+// only the names are sent and the nodes are read from the informer.
+func (e *Extender) nodesOf(args *extenderv1.ExtenderArgs) ([]*v1.Node, error) {
+	if args.Nodes != nil {
+		nodes := make([]*v1.Node, 0, len(args.Nodes.Items))
+		for i := range args.Nodes.Items {
+			nodes = append(nodes, &args.Nodes.Items[i])
+		}
+		return nodes, nil
+	}
+	if args.NodeNames == nil {
+		return nil, nil
+	}
+	nodes := make([]*v1.Node, 0, len(*args.NodeNames))
+	for _, name := range *args.NodeNames {
+		node, err := e.nodeLister.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node %q: %v", name, err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// filter runs PreFilter and Filter, and returns the nodes which pass Filter
+// and the statuses of the nodes which don't.
+func (e *Extender) filter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) ([]*v1.Node, map[string]*framework.Status, error) {
+	statuses := map[string]*framework.Status{}
+	if status := e.plugin.PreFilter(ctx, state, pod); !status.IsSuccess() {
+		if status.Code() == framework.Error {
+			return nil, nil, status.AsError()
+		}
+		for _, node := range nodes {
+			statuses[node.Name] = status
+		}
+		return nil, statuses, nil
+	}
+
+	var feasibleNodes []*v1.Node
+	for _, node := range nodes {
+		nodeInfo := framework.NewNodeInfo()
+		nodeInfo.SetNode(node)
+		status := e.plugin.Filter(ctx, state, pod, nodeInfo)
+		if status.Code() == framework.Error {
+			return nil, nil, status.AsError()
+		}
+		if !status.IsSuccess() {
+			statuses[node.Name] = status
+			continue
+		}
+		feasibleNodes = append(feasibleNodes, node)
+	}
+	return feasibleNodes, statuses, nil
+}
+
+// Filter handles the filter verb.
+func (e *Extender) Filter(ctx context.Context, args *extenderv1.ExtenderArgs) *extenderv1.ExtenderFilterResult {
+	nodes, err := e.nodesOf(args)
+	if err != nil {
+		return &extenderv1.ExtenderFilterResult{Error: err.Error()}
+	}
+	feasibleNodes, statuses, err := e.filter(ctx, framework.NewCycleState(), args.Pod, nodes)
+	if err != nil {
+		return &extenderv1.ExtenderFilterResult{Error: err.Error()}
+	}
+
+	result := &extenderv1.ExtenderFilterResult{
+		FailedNodes:                extenderv1.FailedNodesMap{},
+		FailedAndUnresolvableNodes: extenderv1.FailedNodesMap{},
+	}
+	for nodeName, status := range statuses {
+		reason := strings.Join(status.Reasons(), ", ")
+		if status.Code() == framework.UnschedulableAndUnresolvable {
+			result.FailedAndUnresolvableNodes[nodeName] = reason
+		} else {
+			result.FailedNodes[nodeName] = reason
+		}
+	}
+	if args.NodeNames != nil {
+		names := make([]string, 0, len(feasibleNodes))
+		for _, node := range feasibleNodes {
+			names = append(names, node.Name)
+		}
+		result.NodeNames = &names
+		return result
+	}
+	result.Nodes = &v1.NodeList{}
+	for _, node := range feasibleNodes {
+		result.Nodes.Items = append(result.Nodes.Items, *node)
+	}
+	return result
+}
+
+// Prioritize handles the prioritize verb. The scores are scaled from
+// MaxNodeScore of the plugin to MaxExtenderPriority, and the nodes which don't
+// pass Filter are scored as 0.
+func (e *Extender) Prioritize(ctx context.Context, args *extenderv1.ExtenderArgs) (*extenderv1.HostPriorityList, error) {
+	nodes, err := e.nodesOf(args)
+	if err != nil {
+		return nil, err
+	}
+	state := framework.NewCycleState()
+	feasibleNodes, _, err := e.filter(ctx, state, args.Pod, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(framework.NodeScoreList, 0, len(feasibleNodes))
+	if len(feasibleNodes) > 0 {
+		if status := e.plugin.PreScore(ctx, state, args.Pod, feasibleNodes); !status.IsSuccess() {
+			return nil, status.AsError()
+		}
+		for _, node := range feasibleNodes {
+			score, status := e.plugin.Score(ctx, state, args.Pod, node.Name)
+			if !status.IsSuccess() {
+				return nil, status.AsError()
+			}
+			scores = append(scores, framework.NodeScore{Name: node.Name, Score: score})
+		}
+		if ext := e.plugin.ScoreExtensions(); ext != nil {
+			if status := ext.NormalizeScore(ctx, state, args.Pod, scores); !status.IsSuccess() {
+				return nil, status.AsError()
+			}
+		}
+	}
+
+	byName := make(map[string]int64, len(scores))
+	for _, score := range scores {
+		byName[score.Name] = score.Score * extenderv1.MaxExtenderPriority / framework.MaxNodeScore
+	}
+	result := make(extenderv1.HostPriorityList, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, extenderv1.HostPriority{Host: node.Name, Score: byName[node.Name]})
+	}
+	return &result, nil
+}
+
+// Handler returns the handler serving the filter and the prioritize verbs
+// at /filter and /prioritize, and the metrics of the plugin at /metrics.
+func (e *Extender) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/filter", func(w http.ResponseWriter, r *http.Request) {
+		args := &extenderv1.ExtenderArgs{}
+		if !decodeArgs(w, r, args) {
+			return
+		}
+		writeResult(w, e.Filter(r.Context(), args))
+	})
+	mux.HandleFunc("/prioritize", func(w http.ResponseWriter, r *http.Request) {
+		args := &extenderv1.ExtenderArgs{}
+		if !decodeArgs(w, r, args) {
+			return
+		}
+		result, err := e.Prioritize(r.Context(), args)
+		if err != nil {
+			klog.ErrorS(err, "Failed to prioritize nodes", "pod", klog.KObj(args.Pod))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResult(w, result)
+	})
+	mux.Handle("/metrics", legacyregistry.Handler())
+	return mux
+}
+
+func decodeArgs(w http.ResponseWriter, r *http.Request, args *extenderv1.ExtenderArgs) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if args.Pod == nil {
+		http.Error(w, "pod is required", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		klog.ErrorS(err, "Failed to write the extender result")
+	}
+}
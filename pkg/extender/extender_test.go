@@ -0,0 +1,143 @@
+package extender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+func newTestExtender(t *testing.T, ctx context.Context) (*Extender, []v1.Node, *v1.Pod) {
+	waitForFirstConsumer := storagev1.VolumeBindingWaitForFirstConsumer
+	storageCapacity := true
+	className := "wait-sc"
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "zone-a-node-a", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "zone-b-node-a", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-b"}}},
+	}
+	capacityOf := func(name, zone, capacity string) *storagev1beta1.CSIStorageCapacity {
+		q := resource.MustParse(capacity)
+		return &storagev1beta1.CSIStorageCapacity{
+			ObjectMeta:       metav1.ObjectMeta{Name: name, Namespace: v1.NamespaceDefault},
+			StorageClassName: className,
+			NodeTopology:     &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/zone": zone}},
+			Capacity:         &q,
+		}
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-a", Namespace: v1.NamespaceDefault},
+		Spec: v1.PersistentVolumeClaimSpec{
+			StorageClassName: &className,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("30Gi")},
+			},
+		},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-a", Namespace: v1.NamespaceDefault},
+		Spec: v1.PodSpec{
+			Volumes: []v1.Volume{{
+				Name:         "data",
+				VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.Name}},
+			}},
+		},
+	}
+	client := fake.NewSimpleClientset(
+		&nodes[0],
+		&nodes[1],
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: className}, Provisioner: "wait", VolumeBindingMode: &waitForFirstConsumer},
+		&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "wait"}, Spec: storagev1.CSIDriverSpec{StorageCapacity: &storageCapacity}},
+		capacityOf("csisc-1", "zone-a", "10Gi"),
+		capacityOf("csisc-2", "zone-b", "100Gi"),
+		pvc,
+	)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	fh, err := frameworkruntime.NewFramework(nil, nil,
+		frameworkruntime.WithClientSet(client),
+		frameworkruntime.WithInformerFactory(informerFactory),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := New(ctx, &config.StorageCapacityPrioritizationArgs{}, fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+	return ext, nodes, pod
+}
+
+func TestExtenderFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ext, nodes, pod := newTestExtender(t, ctx)
+
+	result := ext.Filter(ctx, &extenderv1.ExtenderArgs{Pod: pod, Nodes: &v1.NodeList{Items: nodes}})
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	if result.Nodes == nil || len(result.Nodes.Items) != 1 || result.Nodes.Items[0].Name != nodes[1].Name {
+		t.Errorf("nodes do not match got: %+v, want: %q", result.Nodes, nodes[1].Name)
+	}
+	if _, ok := result.FailedAndUnresolvableNodes[nodes[0].Name]; !ok || len(result.FailedAndUnresolvableNodes) != 1 {
+		t.Errorf("failed nodes do not match got: %v, want: %q", result.FailedAndUnresolvableNodes, nodes[0].Name)
+	}
+
+	// The scheduler sends only the names when the extender is nodeCacheCapable.
+	names := []string{nodes[0].Name, nodes[1].Name}
+	result = ext.Filter(ctx, &extenderv1.ExtenderArgs{Pod: pod, NodeNames: &names})
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	if result.NodeNames == nil || !reflect.DeepEqual(*result.NodeNames, []string{nodes[1].Name}) {
+		t.Errorf("node names do not match got: %v, want: %v", result.NodeNames, []string{nodes[1].Name})
+	}
+	if result.Nodes != nil {
+		t.Errorf("nodes are not expected for the node names got: %+v", result.Nodes)
+	}
+}
+
+func TestExtenderPrioritize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ext, nodes, pod := newTestExtender(t, ctx)
+
+	body, err := json.Marshal(&extenderv1.ExtenderArgs{Pod: pod, Nodes: &v1.NodeList{Items: nodes}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	ext.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/prioritize", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code does not match got: %d, want: %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	got := extenderv1.HostPriorityList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	// 30Gi of 100Gi is scored as 30 by MostAllocated, which is 3 in the
+	// range of the extender.
+	expect := extenderv1.HostPriorityList{
+		{Host: nodes[0].Name, Score: 0},
+		{Host: nodes[1].Name, Score: 3},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("priorities do not match got: %v, want: %v", got, expect)
+	}
+}
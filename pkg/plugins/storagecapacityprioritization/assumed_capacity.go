@@ -0,0 +1,163 @@
+package storagecapacityprioritization
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// assumedCapacityKey identifies a topology segment of a storage class,
+// which is published as a CSIStorageCapacity object.
+type assumedCapacityKey struct {
+	storageClassName string
+	segment          string
+}
+
+func newAssumedCapacityKey(capacity *csiStorageCapacity) (assumedCapacityKey, error) {
+	segment, err := cache.MetaNamespaceKeyFunc(capacity)
+	if err != nil {
+		return assumedCapacityKey{}, err
+	}
+	return assumedCapacityKey{storageClassName: capacity.StorageClassName, segment: segment}, nil
+}
+
+// assumedCapacity is the capacity which is going to be consumed by the claims
+// of a reserved pod but is not reflected in the CSIStorageCapacity object yet.
+type assumedCapacity struct {
+	claims []types.NamespacedName
+	bytes  int64
+	// capacity is the capacity published by the CSIStorageCapacity object
+	// when the capacity was assumed.
+	capacity int64
+}
+
+// assumedCapacityCache keeps the capacity assumed by the reserved pods until
+// the claims are bound or the capacity published by the CSIStorageCapacity
+// object goes down. An update of the object which doesn't reflect the
+// provisioned volumes yet, e.g. a change of the labels or a resync, keeps the
+// assumed capacity.
+type assumedCapacityCache struct {
+	sync.Mutex
+	pvcLister corelisters.PersistentVolumeClaimLister
+	assumed   map[assumedCapacityKey]map[types.UID]*assumedCapacity
+}
+
+func newAssumedCapacityCache(pvcLister corelisters.PersistentVolumeClaimLister) *assumedCapacityCache {
+	return &assumedCapacityCache{
+		pvcLister: pvcLister,
+		assumed:   map[assumedCapacityKey]map[types.UID]*assumedCapacity{},
+	}
+}
+
+// assume records that the claims of the pod consume bytes from the capacity.
+func (c *assumedCapacityCache) assume(podUID types.UID, capacity *csiStorageCapacity, claims []*v1.PersistentVolumeClaim, bytes int64) error {
+	key, err := newAssumedCapacityKey(capacity)
+	if err != nil {
+		return err
+	}
+	names := make([]types.NamespacedName, 0, len(claims))
+	for _, claim := range claims {
+		names = append(names, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.assumed[key] == nil {
+		c.assumed[key] = map[types.UID]*assumedCapacity{}
+	}
+	c.assumed[key][podUID] = &assumedCapacity{
+		claims:   names,
+		bytes:    bytes,
+		capacity: publishedBytes(capacity),
+	}
+	return nil
+}
+
+// forget removes the capacity assumed by the pod.
+func (c *assumedCapacityCache) forget(podUID types.UID) {
+	c.Lock()
+	defer c.Unlock()
+	for key, byPod := range c.assumed {
+		delete(byPod, podUID)
+		if len(byPod) == 0 {
+			delete(c.assumed, key)
+		}
+	}
+}
+
+// assumedBytes returns the bytes assumed from the capacity.
+// The entries which are already reflected in the capacity are expired. The
+// claims are looked up without holding the lock, since this is called by
+// Filter for every node.
+func (c *assumedCapacityCache) assumedBytes(capacity *csiStorageCapacity) int64 {
+	if c == nil {
+		return 0
+	}
+	key, err := newAssumedCapacityKey(capacity)
+	if err != nil {
+		klog.ErrorS(err, "Unexpected error getting a key of the csi storage capacity", "capacity", klog.KObj(capacity))
+		return 0
+	}
+
+	c.Lock()
+	entries := make(map[types.UID]*assumedCapacity, len(c.assumed[key]))
+	for podUID, assumed := range c.assumed[key] {
+		entries[podUID] = assumed
+	}
+	c.Unlock()
+
+	published := publishedBytes(capacity)
+	var total int64
+	var expired []types.UID
+	for podUID, assumed := range entries {
+		if published < assumed.capacity || c.claimsBound(assumed.claims) {
+			expired = append(expired, podUID)
+			continue
+		}
+		total += assumed.bytes
+	}
+	if len(expired) == 0 {
+		return total
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, podUID := range expired {
+		// The pod may be assumed again while the lock is released.
+		if c.assumed[key][podUID] == entries[podUID] {
+			delete(c.assumed[key], podUID)
+		}
+	}
+	if len(c.assumed[key]) == 0 {
+		delete(c.assumed, key)
+	}
+	return total
+}
+
+// publishedBytes returns the capacity published by the CSIStorageCapacity
+// object, or 0 when it's not published.
+func publishedBytes(capacity *csiStorageCapacity) int64 {
+	if capacity.Capacity == nil {
+		return 0
+	}
+	return capacity.Capacity.Value()
+}
+
+func (c *assumedCapacityCache) claimsBound(claims []types.NamespacedName) bool {
+	for _, name := range claims {
+		claim, err := c.pvcLister.PersistentVolumeClaims(name.Namespace).Get(name.Name)
+		if err != nil {
+			// A claim which is not found may be a claim of a generic ephemeral
+			// volume which is not created yet.
+			return false
+		}
+		if claim.Spec.VolumeName == "" {
+			return false
+		}
+	}
+	return true
+}
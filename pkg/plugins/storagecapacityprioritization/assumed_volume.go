@@ -0,0 +1,65 @@
+package storagecapacityprioritization
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// assumedVolumeCache keeps the PersistentVolumes matched to the claims of the
+// reserved pods until the binding is reflected in the PersistentVolumes, in
+// the same way as the assume cache of the VolumeBinding plugin, so that they
+// are not matched to the claims of the other pods.
+type assumedVolumeCache struct {
+	sync.Mutex
+	// assumed is the UID of the pod per PersistentVolume name.
+	assumed map[string]types.UID
+}
+
+func newAssumedVolumeCache() *assumedVolumeCache {
+	return &assumedVolumeCache{assumed: map[string]types.UID{}}
+}
+
+// assume records that the PersistentVolumes are matched to the claims of the
+// pod.
+func (c *assumedVolumeCache) assume(podUID types.UID, pvs []*v1.PersistentVolume) {
+	c.Lock()
+	defer c.Unlock()
+	for _, pv := range pvs {
+		c.assumed[pv.Name] = podUID
+	}
+}
+
+// forget removes the PersistentVolumes assumed by the pod.
+func (c *assumedVolumeCache) forget(podUID types.UID) {
+	c.Lock()
+	defer c.Unlock()
+	for name, uid := range c.assumed {
+		if uid == podUID {
+			delete(c.assumed, name)
+		}
+	}
+}
+
+// available returns the PersistentVolumes which are not assumed by the
+// reserved pods. The entries whose PersistentVolume is already claimed are
+// expired, since the PersistentVolume isn't matched to other claims anymore.
+func (c *assumedVolumeCache) available(pvs []*v1.PersistentVolume) []*v1.PersistentVolume {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.assumed) == 0 {
+		return pvs
+	}
+	result := make([]*v1.PersistentVolume, 0, len(pvs))
+	for _, pv := range pvs {
+		if _, ok := c.assumed[pv.Name]; ok {
+			if pv.Spec.ClaimRef != nil {
+				delete(c.assumed, pv.Name)
+			}
+			continue
+		}
+		result = append(result, pv)
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package storagecapacityprioritization
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// The capacity evaluation is implemented by the storagecapacity package so
+// that it can be reused outside of the scheduler. The types are aliased to
+// keep the names used across the plugin.
+type (
+	csiStorageCapacity     = storagecapacity.CSIStorageCapacity
+	claimGroup             = storagecapacity.ClaimGroup
+	claimsByStorageClass   = storagecapacity.ClaimsByStorageClass
+	storageClassCapacities = storagecapacity.ClassCapacities
+	capacitySelection      = storagecapacity.Selection
+	filterReason           = storagecapacity.Reason
+	classScore             = storagecapacity.ClassScore
+)
+
+// snapshotCapacities takes the snapshot of the CSIStorageCapacity objects of
+// the storage classes of the claims. The storage classes which are not found
+// are not included.
+func (pl *StorageCapacityPrioritization) snapshotCapacities(claims []*v1.PersistentVolumeClaim) (map[string]*storageClassCapacities, error) {
+	snapshot := map[string]*storageClassCapacities{}
+	for _, claim := range claims {
+		className := storagecapacity.StorageClassName(claim)
+		if _, ok := snapshot[className]; ok {
+			continue
+		}
+		class, err := pl.classLister.Get(className)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to find storage class %q err=%v", className, err)
+		}
+
+		driver, err := pl.csiDriverLister.Get(class.Provisioner)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to find csi driver object %q err=%v", class.Provisioner, err)
+			}
+			driver = nil
+		}
+		classCapacities := storagecapacity.NewClassCapacities(&pl.args, class, driver, nil)
+		snapshot[className] = classCapacities
+		if !classCapacities.Tracked {
+			untrackedCapacityPods.WithLabelValues(className).Inc()
+			continue
+		}
+
+		capacities, err := pl.csiStorageCapacityLister.ListByStorageClass(className)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find csi storage capacities err=%v", err)
+		}
+		for _, capacity := range capacities {
+			if pl.assumedCapacities.assumedBytes(capacity) > 0 {
+				staleCapacities.WithLabelValues(className).Inc()
+			}
+		}
+		classCapacities.Capacities = capacities
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,206 @@
+package storagecapacityprioritization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+const (
+	csiStorageCapacitiesResource = "csistoragecapacities"
+	storageClassIndex            = "storageClassName"
+
+	// csiStorageCapacitySyncTimeout is how long the plugin waits for the
+	// storage.k8s.io/v1 CSIStorageCapacity informer to sync.
+	csiStorageCapacitySyncTimeout = time.Minute
+)
+
+var csiStorageCapacityV1 = schema.GroupVersionResource{
+	Group:    storagev1beta1.GroupName,
+	Version:  "v1",
+	Resource: csiStorageCapacitiesResource,
+}
+
+func toCSIStorageCapacity(obj interface{}) (*csiStorageCapacity, error) {
+	switch o := obj.(type) {
+	case *storagev1beta1.CSIStorageCapacity:
+		return storagecapacity.NewFromV1beta1(o), nil
+	case *unstructured.Unstructured:
+		return storagecapacity.NewFromUnstructured(o)
+	}
+	return nil, fmt.Errorf("unexpected object type %T in csi storage capacity informer", obj)
+}
+
+func storageClassIndexFunc(obj interface{}) ([]string, error) {
+	switch o := obj.(type) {
+	case *storagev1beta1.CSIStorageCapacity:
+		return []string{o.StorageClassName}, nil
+	case *unstructured.Unstructured:
+		className, _, err := unstructured.NestedString(o.Object, "storageClassName")
+		if err != nil {
+			return nil, err
+		}
+		return []string{className}, nil
+	}
+	return nil, fmt.Errorf("unexpected object type %T in csi storage capacity informer", obj)
+}
+
+// csiStorageCapacityLister lists the CSIStorageCapacity objects regardless of
+// the API version served by the cluster.
+type csiStorageCapacityLister interface {
+	List() ([]*csiStorageCapacity, error)
+	ListByStorageClass(className string) ([]*csiStorageCapacity, error)
+}
+
+// informerCSIStorageCapacityLister lists the CSIStorageCapacity objects from
+// an informer indexed by the storage class name. The converted objects are
+// cached until the resource version of the objects changes. The objects are
+// listed in the order of the namespace and the name because the informer
+// returns them in random order.
+type informerCSIStorageCapacityLister struct {
+	indexer cache.Indexer
+
+	sync.Mutex
+	converted map[string]*csiStorageCapacity
+}
+
+func newInformerCSIStorageCapacityLister(informer cache.SharedIndexInformer) (*informerCSIStorageCapacityLister, error) {
+	if _, ok := informer.GetIndexer().GetIndexers()[storageClassIndex]; !ok {
+		if err := informer.AddIndexers(cache.Indexers{storageClassIndex: storageClassIndexFunc}); err != nil {
+			return nil, err
+		}
+	}
+	l := &informerCSIStorageCapacityLister{
+		indexer:   informer.GetIndexer(),
+		converted: map[string]*csiStorageCapacity{},
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: l.forget,
+	})
+	return l, nil
+}
+
+func (l *informerCSIStorageCapacityLister) List() ([]*csiStorageCapacity, error) {
+	return l.convert(l.indexer.List())
+}
+
+func (l *informerCSIStorageCapacityLister) ListByStorageClass(className string) ([]*csiStorageCapacity, error) {
+	objs, err := l.indexer.ByIndex(storageClassIndex, className)
+	if err != nil {
+		return nil, err
+	}
+	return l.convert(objs)
+}
+
+func (l *informerCSIStorageCapacityLister) convert(objs []interface{}) ([]*csiStorageCapacity, error) {
+	l.Lock()
+	defer l.Unlock()
+	result := make([]*csiStorageCapacity, 0, len(objs))
+	for _, obj := range objs {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return nil, err
+		}
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		if cached, ok := l.converted[key]; ok && cached.ResourceVersion != "" && cached.ResourceVersion == accessor.GetResourceVersion() {
+			result = append(result, cached)
+			continue
+		}
+		capacity, err := toCSIStorageCapacity(obj)
+		if err != nil {
+			return nil, err
+		}
+		l.converted[key] = capacity
+		result = append(result, capacity)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (l *informerCSIStorageCapacityLister) forget(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	delete(l.converted, key)
+}
+
+// servesCSIStorageCapacityV1 reports whether the cluster serves storage.k8s.io/v1 CSIStorageCapacity.
+func servesCSIStorageCapacityV1(handle framework.Handle) (bool, error) {
+	resources, err := handle.ClientSet().Discovery().ServerResourcesForGroupVersion(csiStorageCapacityV1.GroupVersion().String())
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == csiStorageCapacitiesResource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newCSIStorageCapacityLister returns the lister of storage.k8s.io/v1 CSIStorageCapacity
+// when the cluster serves it, and falls back to storage.k8s.io/v1beta1 otherwise.
+// The v1 objects are watched by a dynamic informer because the shared informer
+// factory of the scheduler only has the v1beta1 informer. The dynamic informer
+// is stopped when the context is canceled.
+func newCSIStorageCapacityLister(ctx context.Context, handle framework.Handle) (csiStorageCapacityLister, error) {
+	v1Served, err := servesCSIStorageCapacityV1(handle)
+	if err != nil {
+		klog.ErrorS(err, "Failed to discover the served version of csi storage capacity, falling back to v1beta1")
+	}
+	if !v1Served {
+		klog.V(2).InfoS("Using storage.k8s.io/v1beta1 csi storage capacities")
+		return newInformerCSIStorageCapacityLister(handle.SharedInformerFactory().Storage().V1beta1().CSIStorageCapacities().Informer())
+	}
+	if handle.KubeConfig() == nil {
+		return nil, fmt.Errorf("the cluster serves storage.k8s.io/v1 csi storage capacities but no kubeconfig is available to watch them")
+	}
+
+	client, err := dynamic.NewForConfig(handle.KubeConfig())
+	if err != nil {
+		return nil, err
+	}
+	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := informerFactory.ForResource(csiStorageCapacityV1)
+	lister, err := newInformerCSIStorageCapacityLister(informer.Informer())
+	if err != nil {
+		return nil, err
+	}
+	informerFactory.Start(ctx.Done())
+	syncCtx, cancel := context.WithTimeout(ctx, csiStorageCapacitySyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("failed to wait for csi storage capacity informer to sync within %s", csiStorageCapacitySyncTimeout)
+	}
+	klog.V(2).InfoS("Using storage.k8s.io/v1 csi storage capacities")
+	return lister, nil
+}
@@ -0,0 +1,212 @@
+package storagecapacityprioritization
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+	storageutil "k8s.io/kubernetes/pkg/apis/storage/v1/util"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// getClaimsToBind returns the unbound claims of the pod whose storage class
+// delays the binding until a pod is scheduled. The other claims are either
+// bound already or handled by the VolumeBinding plugin.
+// The claims of the generic ephemeral volumes which are not created yet are
+// synthesized from the volume claim templates.
+func (pl *StorageCapacityPrioritization) getClaimsToBind(pod *v1.Pod) ([]*v1.PersistentVolumeClaim, error) {
+	var claimsToBind []*v1.PersistentVolumeClaim
+	for i := range pod.Spec.Volumes {
+		vol := &pod.Spec.Volumes[i]
+		var claim *v1.PersistentVolumeClaim
+		var err error
+		switch {
+		case vol.PersistentVolumeClaim != nil:
+			claim, err = pl.pvcLister.PersistentVolumeClaims(pod.Namespace).Get(vol.PersistentVolumeClaim.ClaimName)
+			if err != nil {
+				return nil, fmt.Errorf("error getting PVC \"%s/%s\": %v", pod.Namespace, vol.PersistentVolumeClaim.ClaimName, err)
+			}
+		case vol.Ephemeral != nil:
+			claim, err = pl.getEphemeralClaim(pod, vol)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		// Prebound claims don't need to be provisioned.
+		if claim.Spec.VolumeName != "" {
+			continue
+		}
+		delayBindingMode, err := pvutil.IsDelayBindingMode(claim, pl.classLister)
+		if err != nil {
+			return nil, err
+		}
+		if !delayBindingMode {
+			continue
+		}
+		claimsToBind = append(claimsToBind, claim)
+	}
+	return claimsToBind, nil
+}
+
+// getEphemeralClaim returns the claim of the generic ephemeral volume of the
+// pod. When the claim is not created by the ephemeral volume controller yet,
+// the claim expected to be created from the volume claim template is returned.
+// Its storage class is the default storage class when the template has none,
+// as the DefaultStorageClass admission plugin sets it on creation.
+func (pl *StorageCapacityPrioritization) getEphemeralClaim(pod *v1.Pod, vol *v1.Volume) (*v1.PersistentVolumeClaim, error) {
+	claimName := ephemeralClaimName(pod, vol)
+	claim, err := pl.pvcLister.PersistentVolumeClaims(pod.Namespace).Get(claimName)
+	if err == nil {
+		if !metav1.IsControlledBy(claim, pod) {
+			return nil, fmt.Errorf("PVC \"%s/%s\" was not created for the pod", pod.Namespace, claimName)
+		}
+		return claim, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting PVC \"%s/%s\": %v", pod.Namespace, claimName, err)
+	}
+	if vol.Ephemeral.VolumeClaimTemplate == nil {
+		return nil, fmt.Errorf("volume %q of pod %s/%s has no volume claim template", vol.Name, pod.Namespace, pod.Name)
+	}
+	template := vol.Ephemeral.VolumeClaimTemplate
+	claim = &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        claimName,
+			Namespace:   pod.Namespace,
+			Labels:      template.Labels,
+			Annotations: template.Annotations,
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	if claim.Spec.StorageClassName == nil {
+		class, err := pl.getDefaultStorageClass()
+		if err != nil {
+			return nil, err
+		}
+		if class != nil {
+			claim.Spec.StorageClassName = &class.Name
+		}
+	}
+	return claim, nil
+}
+
+// getDefaultStorageClass returns the storage class annotated as the default
+// in the same way as the DefaultStorageClass admission plugin. It returns nil
+// when there is no default storage class, and an error when there are more
+// than one.
+func (pl *StorageCapacityPrioritization) getDefaultStorageClass() (*storagev1.StorageClass, error) {
+	classes, err := pl.classLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var defaultClasses []*storagev1.StorageClass
+	for _, class := range classes {
+		if storageutil.IsDefaultAnnotation(class.ObjectMeta) {
+			defaultClasses = append(defaultClasses, class)
+		}
+	}
+	if len(defaultClasses) == 0 {
+		return nil, nil
+	}
+	if len(defaultClasses) > 1 {
+		return nil, fmt.Errorf("%d default StorageClasses were found", len(defaultClasses))
+	}
+	return defaultClasses[0], nil
+}
+
+// listPersistentVolumes lists the PersistentVolumes which the claims of the pod
+// may be bound to, excluding the ones assumed for the other reserved pods.
+func (pl *StorageCapacityPrioritization) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
+	pvs, err := pl.pvLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes err=%v", err)
+	}
+	return pl.assumedVolumes.available(pvs), nil
+}
+
+// ephemeralClaimName returns the name of the claim which the ephemeral volume
+// controller creates for the generic ephemeral volume of the pod.
+func ephemeralClaimName(pod *v1.Pod, vol *v1.Volume) string {
+	return pod.Name + "-" + vol.Name
+}
+
+// getClaimsToProvision returns the claims which are going to be dynamically
+// provisioned when the pod is scheduled to the node, in the same way as the
+// VolumeBinding plugin finds them: the claims which have no matching
+// PersistentVolume available on the node among pvs, which are listed once
+// per scheduling cycle in PreFilter. It also returns the PersistentVolumes
+// matched to the other claims.
+// The claims which can't be bound or provisioned on the node are not returned
+// because the VolumeBinding plugin rejects the node for them.
+func (pl *StorageCapacityPrioritization) getClaimsToProvision(claimsToBind []*v1.PersistentVolumeClaim, pvs []*v1.PersistentVolume, node *v1.Node) ([]*v1.PersistentVolumeClaim, []*v1.PersistentVolume, error) {
+	var claimsToFindMatching, claimsToProvision []*v1.PersistentVolumeClaim
+	var matchedPVs []*v1.PersistentVolume
+	for _, claim := range claimsToBind {
+		if selectedNode, ok := claim.Annotations[pvutil.AnnSelectedNode]; ok {
+			if selectedNode != node.Name {
+				return nil, nil, nil
+			}
+			claimsToProvision = append(claimsToProvision, claim)
+		} else {
+			claimsToFindMatching = append(claimsToFindMatching, claim)
+		}
+	}
+
+	if len(claimsToFindMatching) > 0 {
+		// Sort all the claims by increasing size request to get the smallest fits
+		sort.SliceStable(claimsToFindMatching, func(i, j int) bool {
+			iSize := claimsToFindMatching[i].Spec.Resources.Requests[v1.ResourceStorage]
+			jSize := claimsToFindMatching[j].Spec.Resources.Requests[v1.ResourceStorage]
+			return iSize.Cmp(jSize) == -1
+		})
+		chosenPVs := map[string]*v1.PersistentVolume{}
+		for _, claim := range claimsToFindMatching {
+			var classPVs []*v1.PersistentVolume
+			for _, pv := range pvs {
+				if pv.Spec.StorageClassName == storagecapacity.StorageClassName(claim) {
+					classPVs = append(classPVs, pv)
+				}
+			}
+			pv, err := pvutil.FindMatchingVolume(claim, classPVs, node, chosenPVs, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if pv != nil {
+				// matching PV needs to be excluded so we don't select it again
+				chosenPVs[pv.Name] = pv
+				matchedPVs = append(matchedPVs, pv)
+				continue
+			}
+			claimsToProvision = append(claimsToProvision, claim)
+		}
+	}
+
+	dynamicProvisions := make([]*v1.PersistentVolumeClaim, 0, len(claimsToProvision))
+	for _, claim := range claimsToProvision {
+		className := storagecapacity.StorageClassName(claim)
+		class, err := pl.classLister.Get(className)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find storage class %q", className)
+		}
+		if class.Provisioner == "" || class.Provisioner == pvutil.NotSupportedProvisioner {
+			klog.V(4).InfoS("Storage class of claim does not support dynamic provisioning", "storageClassName", className, "PVC", klog.KObj(claim))
+			return nil, nil, nil
+		}
+		if !v1helper.MatchTopologySelectorTerms(class.AllowedTopologies, labels.Set(node.Labels)) {
+			klog.V(4).InfoS("Node cannot satisfy provisioning topology requirements of claim", "node", klog.KObj(node), "PVC", klog.KObj(claim))
+			return nil, nil, nil
+		}
+		dynamicProvisions = append(dynamicProvisions, claim)
+	}
+	return dynamicProvisions, matchedPVs, nil
+}
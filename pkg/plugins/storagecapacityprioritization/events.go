@@ -0,0 +1,83 @@
+package storagecapacityprioritization
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+const (
+	// insufficientStorageCapacityReason is the reason of the events emitted
+	// when no node has enough capacity for the claims of a storage class.
+	insufficientStorageCapacityReason = "InsufficientStorageCapacity"
+	schedulingAction                  = "Scheduling"
+)
+
+// storageClassRejections summarizes the nodes rejected by Filter for the
+// claims of a storage class.
+type storageClassRejections struct {
+	// requested is the bytes requested by the claims of the storage class.
+	requested int64
+	// largestAvailable is the largest capacity available on the rejected nodes.
+	largestAvailable int64
+	// capacityRejected is the number of nodes rejected because the capacity
+	// is not enough for the claims.
+	capacityRejected int
+	// topologyRejected is the number of nodes rejected because no
+	// CSIStorageCapacity object covers them.
+	topologyRejected int
+}
+
+// recordRejection records the reason why a node is rejected.
+// The caller must hold the lock of the state data.
+func (d *stateData) recordRejection(reason *filterReason) {
+	if reason.Type == reasonStorageClassNotFound {
+		return
+	}
+	if d.rejections == nil {
+		d.rejections = map[string]*storageClassRejections{}
+	}
+	r, ok := d.rejections[reason.StorageClassName]
+	if !ok {
+		r = &storageClassRejections{}
+		d.rejections[reason.StorageClassName] = r
+	}
+	r.requested = reason.Requested
+	if reason.Type == reasonNodeNotCovered {
+		r.topologyRejected++
+		return
+	}
+	r.capacityRejected++
+	if reason.Available > r.largestAvailable {
+		r.largestAvailable = reason.Available
+	}
+}
+
+// emitRejectionEvents emits an event on the pod, and on the claims created
+// already, for every storage class whose claims are rejected by Filter.
+func (pl *StorageCapacityPrioritization) emitRejectionEvents(pod *v1.Pod, state *stateData) {
+	if pl.eventRecorder == nil {
+		return
+	}
+	state.Lock()
+	defer state.Unlock()
+	for className, r := range state.rejections {
+		note := "storage class %q: requested %s, largest available %s, %d node(s) rejected for insufficient capacity, %d node(s) not covered by csi storage capacity objects"
+		args := []interface{}{
+			className,
+			resource.NewQuantity(r.requested, resource.BinarySI).String(),
+			resource.NewQuantity(r.largestAvailable, resource.BinarySI).String(),
+			r.capacityRejected,
+			r.topologyRejected,
+		}
+		pl.eventRecorder.Eventf(pod, nil, v1.EventTypeWarning, insufficientStorageCapacityReason, schedulingAction, note, args...)
+		for _, claim := range state.claimsToBind {
+			// The claims synthesized from generic ephemeral volumes don't exist yet.
+			if claim.UID == "" || storagecapacity.StorageClassName(claim) != className {
+				continue
+			}
+			pl.eventRecorder.Eventf(claim, pod, v1.EventTypeWarning, insufficientStorageCapacityReason, schedulingAction, note, args...)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package storagecapacityprioritization
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// scoreExplanationAnnotation is the annotation of a pod which the scores of
+// the nodes are recorded in when ScoreExplanationNodes is set.
+const scoreExplanationAnnotation = "storage-capacity-prioritization.bells17.io/score-explanation"
+
+// nodeScoreExplanation explains the score of a node. Score is the score
+// which the plugin gave the framework, after NormalizeScore when the scores
+// are normalized.
+type nodeScoreExplanation struct {
+	Node  string `json:"node"`
+	Score int64  `json:"score"`
+	// ScoreBeforeNormalization is the score before NormalizeScore. It's only
+	// set when the scores are normalized.
+	ScoreBeforeNormalization *int64        `json:"scoreBeforeNormalization,omitempty"`
+	StorageClasses           []*classScore `json:"storageClasses"`
+}
+
+// scoreExplanation is the value of the score explanation annotation.
+type scoreExplanation struct {
+	SelectedNode string                  `json:"selectedNode"`
+	Nodes        []*nodeScoreExplanation `json:"nodes"`
+}
+
+// explainScores returns the explanation of the scores of the top n nodes.
+// The selected node is always included. scoresBeforeNormalization is nil
+// when the scores are not normalized.
+func explainScores(selectedNode string, scores, scoresBeforeNormalization map[string]int64, classScores map[string][]*classScore, n int) *scoreExplanation {
+	nodeNames := make([]string, 0, len(classScores))
+	for nodeName := range classScores {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Slice(nodeNames, func(i, j int) bool {
+		if scores[nodeNames[i]] != scores[nodeNames[j]] {
+			return scores[nodeNames[i]] > scores[nodeNames[j]]
+		}
+		return nodeNames[i] < nodeNames[j]
+	})
+
+	explanation := &scoreExplanation{SelectedNode: selectedNode}
+	for i, nodeName := range nodeNames {
+		if i >= n && nodeName != selectedNode {
+			continue
+		}
+		node := &nodeScoreExplanation{
+			Node:           nodeName,
+			Score:          scores[nodeName],
+			StorageClasses: classScores[nodeName],
+		}
+		if score, ok := scoresBeforeNormalization[nodeName]; ok {
+			node.ScoreBeforeNormalization = &score
+		}
+		explanation.Nodes = append(explanation.Nodes, node)
+	}
+	return explanation
+}
+
+// PostBind records the explanation of the scores of the top nodes on the pod
+// as an annotation when ScoreExplanationNodes is set.
+// The failure is only logged because the pod is already bound.
+func (pl *StorageCapacityPrioritization) PostBind(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodeName string) {
+	if pl.args.ScoreExplanationNodes <= 0 {
+		return
+	}
+	state, err := getStateData(cs)
+	if err != nil || len(state.classScores) == 0 {
+		return
+	}
+
+	scores, scoresBeforeNormalization := state.scores, map[string]int64(nil)
+	if state.normalizedScores != nil {
+		scores, scoresBeforeNormalization = state.normalizedScores, state.scores
+	}
+	explanation := explainScores(nodeName, scores, scoresBeforeNormalization, state.classScores, int(pl.args.ScoreExplanationNodes))
+	value, err := json.Marshal(explanation)
+	if err != nil {
+		klog.ErrorS(err, "Failed to marshal the score explanation", "pod", klog.KObj(pod))
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				scoreExplanationAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to marshal the score explanation patch", "pod", klog.KObj(pod))
+		return
+	}
+	if _, err := pl.clientSet.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.ErrorS(err, "Failed to record the score explanation", "pod", klog.KObj(pod))
+	}
+}
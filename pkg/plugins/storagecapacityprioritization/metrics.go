@@ -0,0 +1,91 @@
+package storagecapacityprioritization
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// metricsSubsystem is the subsystem name of the metrics of the plugin.
+const metricsSubsystem = "scheduler_storage_capacity_prioritization"
+
+// The reason labels of filteredNodes.
+const (
+	reasonInsufficientCapacity     = storagecapacity.ReasonInsufficientCapacity
+	reasonExceedsMaximumVolumeSize = storagecapacity.ReasonExceedsMaximumVolumeSize
+	reasonStorageClassNotFound     = storagecapacity.ReasonStorageClassNotFound
+	reasonNodeNotCovered           = storagecapacity.ReasonNodeNotCovered
+)
+
+var (
+	// filteredNodes tracks the number of nodes filtered out per storage class and reason.
+	filteredNodes = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "filtered_nodes_total",
+			Help:           "Number of nodes filtered out because the capacity of the storage class is not enough for the claims",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"storage_class", "reason"},
+	)
+	// nodeScores tracks the distribution of the node scores calculated in PreScore.
+	nodeScores = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "node_scores",
+			Help:           "Distribution of the node scores calculated from the capacity of the storage classes",
+			Buckets:        metrics.LinearBuckets(0, 10, 11),
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// capacityLookupDuration tracks the latency of taking the snapshot of the
+	// CSIStorageCapacity objects in PreFilter.
+	capacityLookupDuration = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "capacity_lookup_duration_seconds",
+			Help:           "Latency of looking up the CSIStorageCapacity objects of the claims of a pod",
+			Buckets:        metrics.ExponentialBuckets(0.0001, 2, 15),
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// staleCapacities tracks the number of CSIStorageCapacity objects which
+	// don't reflect the capacity assumed by the reserved pods yet.
+	staleCapacities = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "stale_capacities_total",
+			Help:           "Number of CSIStorageCapacity objects found not refreshed since the capacity was assumed by reserved pods",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"storage_class"},
+	)
+	// untrackedCapacityPods tracks the number of pods whose claims are not
+	// checked because the CSIDriver doesn't publish the capacity.
+	untrackedCapacityPods = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "untracked_capacity_pods_total",
+			Help:           "Number of pods skipped because the CSIDriver of the storage class does not publish the capacity",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"storage_class"},
+	)
+)
+
+var registerMetricsOnce sync.Once
+
+// registerMetrics registers the metrics of the plugin to the legacy registry,
+// so that they are exposed on the /metrics endpoint of the scheduler.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(filteredNodes)
+		legacyregistry.MustRegister(nodeScores)
+		legacyregistry.MustRegister(capacityLookupDuration)
+		legacyregistry.MustRegister(staleCapacities)
+		legacyregistry.MustRegister(untrackedCapacityPods)
+	})
+}
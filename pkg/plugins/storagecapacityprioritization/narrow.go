@@ -0,0 +1,155 @@
+package storagecapacityprioritization
+
+import (
+	v1 "k8s.io/api/core/v1"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// capacityIndex is the CSIStorageCapacity objects which may be enough for the
+// claims of every storage class, built once per scheduling cycle in PreFilter.
+// A node which none of the objects of a storage class covers can't have
+// enough capacity for the claims of the storage class.
+type capacityIndex struct {
+	// claims are the claims of the storage classes in the index.
+	claims claimsByStorageClass
+	// promising are the objects per storage class which may be enough for
+	// the claims of the storage class.
+	promising map[string][]*csiStorageCapacity
+	// capacities are all the objects per storage class, used to find the
+	// nodes with unknown capacity when it's allowed.
+	capacities map[string]*storageClassCapacities
+	// allowsUnknown reports whether the nodes not covered by any object of
+	// the storage class may pass.
+	allowsUnknown bool
+}
+
+// newCapacityIndex returns the index of the CSIStorageCapacity objects for the
+// claims of the pod. It returns nil when the nodes can't be narrowed down.
+//
+// Only the storage classes whose claims are all going to be provisioned on any
+// node are indexed: the claims of the other storage classes may be bound to
+// the existing PersistentVolumes instead. The index doesn't reject a node which
+// may pass Filter.
+//
+// The scheduling framework of this version has no PreFilterResult yet, so
+// Filter checks the index first, and evaluates only the storage classes which
+// can't have enough capacity on the node to find the reasons.
+func (pl *StorageCapacityPrioritization) newCapacityIndex(claimsToBind []*v1.PersistentVolumeClaim, pvs []*v1.PersistentVolume, capacities map[string]*storageClassCapacities) (*capacityIndex, error) {
+	for _, claim := range claimsToBind {
+		if _, ok := claim.Annotations[pvutil.AnnSelectedNode]; ok {
+			return nil, nil
+		}
+	}
+	claims, err := pl.claimsByStorageClass(claimsToBind)
+	if err != nil {
+		// Filter rejects all the nodes for the storage class not found.
+		return nil, nil
+	}
+
+	index := &capacityIndex{
+		claims:        claimsByStorageClass{},
+		promising:     map[string][]*csiStorageCapacity{},
+		capacities:    capacities,
+		allowsUnknown: pl.args.UnknownCapacity != "" && pl.args.UnknownCapacity != config.RejectUnknownCapacity,
+	}
+	for className, cg := range claims {
+		classCapacities, ok := capacities[className]
+		if !ok || !classCapacities.Tracked || hasMatchablePersistentVolumes(pvs, className, cg) {
+			continue
+		}
+		sizeInBytes, err := cg.TotalRequest()
+		if err != nil {
+			return nil, err
+		}
+		_, largestSize, err := cg.LargestClaim()
+		if err != nil {
+			return nil, err
+		}
+		index.claims[className] = cg
+		index.promising[className] = promisingCapacities(pl.args.CapacityAggregation, classCapacities, sizeInBytes, largestSize, pl.assumedCapacities.assumedBytes)
+	}
+	if len(index.claims) == 0 {
+		return nil, nil
+	}
+	return index, nil
+}
+
+// hopelessClaims returns the claims of the storage classes which can't have
+// enough capacity on the node according to the index.
+func (i *capacityIndex) hopelessClaims(node *v1.Node) claimsByStorageClass {
+	if i == nil {
+		return nil
+	}
+	var hopeless claimsByStorageClass
+	for className, cg := range i.claims {
+		if hasAccessToAny(node, i.promising[className]) {
+			continue
+		}
+		if i.allowsUnknown && !hasAccessToAny(node, i.capacities[className].Capacities) {
+			continue
+		}
+		if hopeless == nil {
+			hopeless = claimsByStorageClass{}
+		}
+		hopeless[className] = cg
+	}
+	return hopeless
+}
+
+// hasMatchablePersistentVolumes reports whether any claim of the claim group
+// may be bound to one of the PersistentVolumes of the storage class.
+func hasMatchablePersistentVolumes(pvs []*v1.PersistentVolume, className string, cg claimGroup) bool {
+	for _, pv := range pvs {
+		if pv.Spec.StorageClassName != className {
+			continue
+		}
+		if pv.Spec.ClaimRef == nil {
+			return true
+		}
+		for _, claim := range cg {
+			if pv.Spec.ClaimRef.Namespace == claim.Namespace && pv.Spec.ClaimRef.Name == claim.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// promisingCapacities returns the CSIStorageCapacity objects which may be
+// selected as sufficient for the claim group. For Sum, every object may add up
+// to enough capacity, so only the objects without capacity are excluded. For
+// Pack, the largest claim has to fit in one of the objects.
+func promisingCapacities(aggregation config.CapacityAggregationType, classCapacities *storageClassCapacities, sizeInBytes, largestClaim int64, assumed storagecapacity.AssumedFunc) []*csiStorageCapacity {
+	required := sizeInBytes
+	if storagecapacity.Packs(aggregation) {
+		required = largestClaim
+	}
+	var result []*csiStorageCapacity
+	for _, capacity := range classCapacities.Capacities {
+		if capacity.Capacity == nil {
+			continue
+		}
+		if aggregation != config.SumCapacityAggregation {
+			if capacity.MaximumVolumeSize != nil && capacity.MaximumVolumeSize.Value() < largestClaim {
+				continue
+			}
+			if storagecapacity.Available(capacity, classCapacities.Policy, assumed) < required {
+				continue
+			}
+		}
+		result = append(result, capacity)
+	}
+	return result
+}
+
+func hasAccessToAny(node *v1.Node, capacities []*csiStorageCapacity) bool {
+	for _, capacity := range capacities {
+		if capacity.Capacity != nil && storagecapacity.NodeHasAccess(node, capacity) {
+			return true
+		}
+	}
+	return false
+}
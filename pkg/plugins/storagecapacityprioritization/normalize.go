@@ -0,0 +1,70 @@
+package storagecapacityprioritization
+
+import (
+	"sort"
+
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// normalizeMinMax rescales the raw scores linearly so that the lowest raw
+// score becomes 0 and the highest raw score becomes MaxNodeScore.
+// The scores are left as they are when all the raw scores are the same.
+func normalizeMinMax(scores framework.NodeScoreList, rawScores map[string]float64) {
+	var min, max float64
+	found := false
+	for _, score := range scores {
+		raw, ok := rawScores[score.Name]
+		if !ok {
+			continue
+		}
+		if !found || raw < min {
+			min = raw
+		}
+		if !found || raw > max {
+			max = raw
+		}
+		found = true
+	}
+	if !found || max == min {
+		return
+	}
+	for i := range scores {
+		raw, ok := rawScores[scores[i].Name]
+		if !ok {
+			continue
+		}
+		scores[i].Score = int64((raw - min) / (max - min) * float64(framework.MaxNodeScore))
+	}
+}
+
+// normalizeRank replaces the raw scores with their ranks spread evenly
+// between 0 and MaxNodeScore. The nodes with the same raw score get the same
+// rank. The scores are left as they are when all the raw scores are the same.
+func normalizeRank(scores framework.NodeScoreList, rawScores map[string]float64) {
+	var distinct []float64
+	seen := map[float64]bool{}
+	for _, score := range scores {
+		raw, ok := rawScores[score.Name]
+		if !ok || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		distinct = append(distinct, raw)
+	}
+	if len(distinct) < 2 {
+		return
+	}
+	sort.Float64s(distinct)
+	ranks := make(map[float64]int64, len(distinct))
+	for i, raw := range distinct {
+		ranks[raw] = int64(i)
+	}
+	maxRank := int64(len(distinct) - 1)
+	for i := range scores {
+		raw, ok := rawScores[scores[i].Name]
+		if !ok {
+			continue
+		}
+		scores[i].Score = ranks[raw] * framework.MaxNodeScore / maxRank
+	}
+}
@@ -0,0 +1,462 @@
+package storagecapacityprioritization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+	volumeutil "k8s.io/kubernetes/pkg/volume/util"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// freedStateKey is the key of the capacity freed by the pods removed from the
+// node in the cycle state, e.g. while the victims of a preemption are chosen.
+const freedStateKey framework.StateKey = Name + "/freed"
+
+// freedCapacities is the capacity freed by the pods removed from the node
+// through RemovePod: the bytes per CSIStorageCapacity object for every pod.
+// During preemption it also holds the capacity which is being freed already,
+// for every terminating pod and every released PersistentVolume.
+type freedCapacities map[types.UID]map[assumedCapacityKey]int64
+
+func (f freedCapacities) Clone() framework.StateData {
+	clone := make(freedCapacities, len(f))
+	for uid, bytes := range f {
+		clone[uid] = bytes
+	}
+	return clone
+}
+
+// freedBytes returns the bytes of the capacity freed by all the removed pods.
+func (f freedCapacities) freedBytes(capacity *csiStorageCapacity) int64 {
+	key, err := newAssumedCapacityKey(capacity)
+	if err != nil {
+		return 0
+	}
+	var freed int64
+	for _, bytes := range f {
+		freed += bytes[key]
+	}
+	return freed
+}
+
+func getFreedCapacities(cs *framework.CycleState) (freedCapacities, bool) {
+	state, err := cs.Read(freedStateKey)
+	if err != nil {
+		return nil, false
+	}
+	freed, ok := state.(freedCapacities)
+	return freed, ok
+}
+
+// assumedFunc returns the bytes assumed from the capacity by the reserved
+// pods, less the bytes freed by the pods removed from the node in the cycle
+// state.
+func (pl *StorageCapacityPrioritization) assumedFunc(cs *framework.CycleState) storagecapacity.AssumedFunc {
+	freed, ok := getFreedCapacities(cs)
+	if !ok || len(freed) == 0 {
+		return pl.assumedCapacities.assumedBytes
+	}
+	return func(capacity *csiStorageCapacity) int64 {
+		return pl.assumedCapacities.assumedBytes(capacity) - freed.freedBytes(capacity)
+	}
+}
+
+// AddPod cancels the capacity credited by RemovePod when the pod is added
+// back to the node.
+func (pl *StorageCapacityPrioritization) AddPod(ctx context.Context, cs *framework.CycleState, podToSchedule *v1.Pod, podInfoToAdd *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	if freed, ok := getFreedCapacities(cs); ok {
+		delete(freed, podInfoToAdd.Pod.UID)
+	}
+	return nil
+}
+
+// RemovePod credits the capacity of the volumes which are deleted with the pod
+// to the CSIStorageCapacity objects they were provisioned from, so that Filter
+// sees the capacity freed by preempting the pod.
+func (pl *StorageCapacityPrioritization) RemovePod(ctx context.Context, cs *framework.CycleState, podToSchedule *v1.Pod, podInfoToRemove *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	state, err := getStateData(cs)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	if len(state.claimsToBind) == 0 || nodeInfo.Node() == nil {
+		return nil
+	}
+	bytes := pl.reclaimableCapacities(podInfoToRemove.Pod, nodeInfo.Node(), state.capacities)
+	if len(bytes) == 0 {
+		return nil
+	}
+	freed, ok := getFreedCapacities(cs)
+	if !ok {
+		freed = freedCapacities{}
+		cs.Write(freedStateKey, freed)
+	}
+	freed[podInfoToRemove.Pod.UID] = bytes
+	return nil
+}
+
+// preemptionCandidate is a node and the pods to be preempted on it.
+type preemptionCandidate struct {
+	nodeName string
+	victims  []*v1.Pod
+}
+
+// preempt finds the node where preempting the fewest lower priority pods frees
+// enough capacity for the claims of the pod, and deletes the pods.
+// Only the nodes which are rejected by this plugin for the insufficient
+// capacity are considered, and only the generic ephemeral volumes of the
+// victims, which are deleted with them, are counted as freed. The victims are
+// removed from a copy of the node and the filter plugins are run on it before
+// anything is deleted, and the pods whose PodDisruptionBudget doesn't allow
+// the disruption are not preempted. The capacity which is being freed already
+// is counted before the victims are chosen, and the node is nominated without
+// deleting anything when it's enough.
+// It returns the name of the node, or an empty string if no node is found.
+func (pl *StorageCapacityPrioritization) preempt(ctx context.Context, cs *framework.CycleState, state *stateData, pod *v1.Pod, statuses framework.NodeToStatusMap) (string, error) {
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == v1.PreemptNever {
+		return "", nil
+	}
+	if !pl.podEligibleToPreemptOthers(pod, statuses) {
+		klog.V(5).InfoS("Pod is not eligible for more preemption because the victims on the nominated node are terminating", "pod", klog.KObj(pod), "node", pod.Status.NominatedNodeName)
+		return "", nil
+	}
+
+	nodeNames := make([]string, 0, len(statuses))
+	for nodeName, status := range statuses {
+		if status.FailedPlugin() == Name && status.Code() == framework.UnschedulableAndUnresolvable {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	}
+	sort.Strings(nodeNames)
+
+	var pdbs []*policyv1.PodDisruptionBudget
+	if pl.pdbLister != nil {
+		var err error
+		pdbs, err = pl.pdbLister.List(labels.Everything())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var best *preemptionCandidate
+	for _, nodeName := range nodeNames {
+		nodeInfo, err := pl.sharedLister.NodeInfos().Get(nodeName)
+		if err != nil {
+			return "", err
+		}
+		if nodeInfo.Node() == nil {
+			continue
+		}
+		insufficient, err := pl.lacksCapacity(state, nodeInfo.Node())
+		if err != nil {
+			return "", err
+		}
+		if !insufficient {
+			continue
+		}
+		victims, ok, err := pl.selectVictims(ctx, cs, state, pod, nodeInfo, pdbs)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		if best == nil || len(victims) < len(best.victims) {
+			best = &preemptionCandidate{nodeName: nodeName, victims: victims}
+		}
+	}
+	if best == nil {
+		return "", nil
+	}
+	if len(best.victims) == 0 {
+		klog.V(2).InfoS("Waiting for the storage capacity being freed", "pod", klog.KObj(pod), "node", best.nodeName)
+		return best.nodeName, nil
+	}
+
+	for _, victim := range best.victims {
+		if err := pl.clientSet.CoreV1().Pods(victim.Namespace).Delete(ctx, victim.Name, metav1.DeleteOptions{}); err != nil {
+			return "", fmt.Errorf("failed to preempt pod %s/%s: %v", victim.Namespace, victim.Name, err)
+		}
+		if pl.eventRecorder != nil {
+			pl.eventRecorder.Eventf(victim, pod, v1.EventTypeNormal, "Preempted", "Preempting", "Preempted by %v/%v on node %v to free storage capacity", pod.Namespace, pod.Name, best.nodeName)
+		}
+	}
+	klog.V(2).InfoS("Preempted pods to free storage capacity", "pod", klog.KObj(pod), "node", best.nodeName, "victims", len(best.victims))
+	return best.nodeName, nil
+}
+
+// lacksCapacity reports whether the claims of some storage class lack the
+// capacity on the node and all the others fit. It returns false when the node
+// can't be made feasible by freeing the capacity, e.g. when no
+// CSIStorageCapacity object covers the node.
+func (pl *StorageCapacityPrioritization) lacksCapacity(state *stateData, node *v1.Node) (bool, error) {
+	claimsToProvision, _, err := pl.getClaimsToProvision(state.claimsToBind, state.pvs, node)
+	if err != nil {
+		return false, err
+	}
+	claims, err := pl.claimsByStorageClass(claimsToProvision)
+	if err != nil {
+		return false, err
+	}
+	insufficient := false
+	for className, cg := range claims {
+		_, reason, err := pl.findCapacity(node, className, cg, state.capacities, pl.assumedCapacities.assumedBytes)
+		if err != nil {
+			return false, err
+		}
+		if reason == nil {
+			continue
+		}
+		if reason.Type != reasonInsufficientCapacity {
+			return false, nil
+		}
+		insufficient = true
+	}
+	return insufficient, nil
+}
+
+// selectVictims removes the lower priority pods whose volumes free capacity
+// from a copy of the node, from the least important one, until the filter
+// plugins pass on the node. The capacity which is being freed already is
+// counted first, and no pod is removed if it's enough. The pods which are
+// terminating already, and the pods whose PodDisruptionBudget doesn't allow
+// the disruption, are skipped.
+// It returns false when the filter plugins don't pass even if all the pods
+// are removed.
+func (pl *StorageCapacityPrioritization) selectVictims(ctx context.Context, cs *framework.CycleState, state *stateData, pod *v1.Pod, nodeInfo *framework.NodeInfo, pdbs []*policyv1.PodDisruptionBudget) ([]*v1.Pod, bool, error) {
+	var candidates []*v1.Pod
+	for _, podInfo := range nodeInfo.Pods {
+		if podInfo.Pod.DeletionTimestamp != nil {
+			continue
+		}
+		if corev1helpers.PodPriority(podInfo.Pod) >= corev1helpers.PodPriority(pod) {
+			continue
+		}
+		if len(pl.reclaimableCapacities(podInfo.Pod, nodeInfo.Node(), state.capacities)) == 0 {
+			continue
+		}
+		candidates = append(candidates, podInfo.Pod)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return schedutil.MoreImportantPod(candidates[j], candidates[i])
+	})
+
+	disruptionsAllowed := make([]int32, len(pdbs))
+	for i, pdb := range pdbs {
+		disruptionsAllowed[i] = pdb.Status.DisruptionsAllowed
+	}
+	stateCopy := cs.Clone()
+	nodeInfoCopy := nodeInfo.Clone()
+	if pending := pl.pendingFreedCapacities(state, nodeInfo); len(pending) > 0 {
+		freed, ok := getFreedCapacities(stateCopy)
+		if !ok {
+			freed = freedCapacities{}
+			stateCopy.Write(freedStateKey, freed)
+		}
+		for uid, bytes := range pending {
+			freed[uid] = bytes
+		}
+		if status := pl.handle.RunFilterPluginsWithNominatedPods(ctx, stateCopy, pod, nodeInfoCopy); status.IsSuccess() {
+			return nil, true, nil
+		}
+	}
+	var victims []*v1.Pod
+	for _, candidate := range candidates {
+		if !allowsDisruption(candidate, pdbs, disruptionsAllowed) {
+			continue
+		}
+		if err := nodeInfoCopy.RemovePod(candidate); err != nil {
+			return nil, false, err
+		}
+		if status := pl.handle.RunPreFilterExtensionRemovePod(ctx, stateCopy, pod, framework.NewPodInfo(candidate), nodeInfoCopy); !status.IsSuccess() {
+			return nil, false, status.AsError()
+		}
+		victims = append(victims, candidate)
+		if status := pl.handle.RunFilterPluginsWithNominatedPods(ctx, stateCopy, pod, nodeInfoCopy); status.IsSuccess() {
+			return victims, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// podEligibleToPreemptOthers reports whether the pod may preempt more pods,
+// in the same way as the DefaultPreemption plugin: a pod whose nominated node
+// has lower priority pods terminating waits for them to be deleted instead of
+// preempting other pods again. The nominated node is rejected by this plugin
+// until the volumes of the victims are deleted, so only the rejection by
+// another plugin makes the pod eligible again.
+func (pl *StorageCapacityPrioritization) podEligibleToPreemptOthers(pod *v1.Pod, statuses framework.NodeToStatusMap) bool {
+	nodeName := pod.Status.NominatedNodeName
+	if nodeName == "" {
+		return true
+	}
+	if status, ok := statuses[nodeName]; ok && status.FailedPlugin() != Name && status.Code() == framework.UnschedulableAndUnresolvable {
+		return true
+	}
+	nodeInfo, err := pl.sharedLister.NodeInfos().Get(nodeName)
+	if err != nil || nodeInfo == nil {
+		return true
+	}
+	priority := corev1helpers.PodPriority(pod)
+	for _, p := range nodeInfo.Pods {
+		if p.Pod.DeletionTimestamp != nil && corev1helpers.PodPriority(p.Pod) < priority {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingFreedCapacities returns the capacity of the node which is being
+// freed already: the capacity of the volumes of the terminating pods on the
+// node, and of the released PersistentVolumes which are going to be deleted.
+// It's counted as freed while the victims are chosen, so that the following
+// scheduling cycles don't preempt more pods for the same capacity.
+func (pl *StorageCapacityPrioritization) pendingFreedCapacities(state *stateData, nodeInfo *framework.NodeInfo) freedCapacities {
+	node := nodeInfo.Node()
+	pending := freedCapacities{}
+	for _, podInfo := range nodeInfo.Pods {
+		if podInfo.Pod.DeletionTimestamp == nil {
+			continue
+		}
+		if bytes := pl.reclaimableCapacities(podInfo.Pod, node, state.capacities); len(bytes) > 0 {
+			pending[podInfo.Pod.UID] = bytes
+		}
+	}
+	for _, pv := range state.pvs {
+		if pv.Status.Phase != v1.VolumeReleased || pv.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
+			continue
+		}
+		if pv.Spec.NodeAffinity == nil || volumeutil.CheckNodeAffinity(pv, node.Labels) != nil {
+			continue
+		}
+		capacity := provisionedFrom(pv, node, state.capacities[pv.Spec.StorageClassName])
+		if capacity == nil {
+			continue
+		}
+		key, err := newAssumedCapacityKey(capacity)
+		if err != nil {
+			continue
+		}
+		size := pv.Spec.Capacity[v1.ResourceStorage]
+		pending[pv.UID] = map[assumedCapacityKey]int64{key: size.Value()}
+	}
+	return pending
+}
+
+// allowsDisruption reports whether the PodDisruptionBudgets matching the pod
+// allow deleting it, and consumes the disruptions allowed by them if so.
+// The pods which are already being disrupted don't consume the budget, in the
+// same way as the DefaultPreemption plugin.
+func allowsDisruption(pod *v1.Pod, pdbs []*policyv1.PodDisruptionBudget, disruptionsAllowed []int32) bool {
+	if len(pod.Labels) == 0 {
+		return true
+	}
+	var matched []int
+	for i, pdb := range pdbs {
+		if pdb.Namespace != pod.Namespace {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if _, ok := pdb.Status.DisruptedPods[pod.Name]; ok {
+			continue
+		}
+		if disruptionsAllowed[i] <= 0 {
+			return false
+		}
+		matched = append(matched, i)
+	}
+	for _, i := range matched {
+		disruptionsAllowed[i]--
+	}
+	return true
+}
+
+// reclaimableCapacities returns the bytes per CSIStorageCapacity object which
+// are freed on the node when the pod is deleted: the capacity of the local
+// volumes of the generic ephemeral volumes of the pod whose reclaim policy is
+// Delete. The bytes are credited only to the object of the storage class
+// whose topology matches the node affinity of the PersistentVolume, and not at
+// all when it's ambiguous.
+func (pl *StorageCapacityPrioritization) reclaimableCapacities(pod *v1.Pod, node *v1.Node, capacities map[string]*storageClassCapacities) map[assumedCapacityKey]int64 {
+	reclaimable := map[assumedCapacityKey]int64{}
+	for i := range pod.Spec.Volumes {
+		vol := &pod.Spec.Volumes[i]
+		if vol.Ephemeral == nil {
+			continue
+		}
+		claim, err := pl.pvcLister.PersistentVolumeClaims(pod.Namespace).Get(ephemeralClaimName(pod, vol))
+		if err != nil || !metav1.IsControlledBy(claim, pod) || claim.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := pl.pvLister.Get(claim.Spec.VolumeName)
+		if err != nil || pv.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
+			continue
+		}
+		if pv.Spec.NodeAffinity == nil || volumeutil.CheckNodeAffinity(pv, node.Labels) != nil {
+			continue
+		}
+		capacity := provisionedFrom(pv, node, capacities[pv.Spec.StorageClassName])
+		if capacity == nil {
+			continue
+		}
+		key, err := newAssumedCapacityKey(capacity)
+		if err != nil {
+			continue
+		}
+		size := pv.Spec.Capacity[v1.ResourceStorage]
+		reclaimable[key] += size.Value()
+	}
+	return reclaimable
+}
+
+// provisionedFrom returns the CSIStorageCapacity object of the node which the
+// PersistentVolume was provisioned from: the only one whose topology matches
+// the labels required by the node affinity of the PersistentVolume. It
+// returns nil when no object or more than one object matches.
+func provisionedFrom(pv *v1.PersistentVolume, node *v1.Node, classCapacities *storageClassCapacities) *csiStorageCapacity {
+	if classCapacities == nil || pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return nil
+	}
+	var topologies []labels.Set
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		topology := labels.Set{}
+		for _, expr := range term.MatchExpressions {
+			if expr.Operator == v1.NodeSelectorOpIn && len(expr.Values) == 1 {
+				topology[expr.Key] = expr.Values[0]
+			}
+		}
+		if len(topology) > 0 {
+			topologies = append(topologies, topology)
+		}
+	}
+
+	var found *csiStorageCapacity
+	for _, capacity := range classCapacities.Capacities {
+		if capacity.Selector() == nil || !storagecapacity.NodeHasAccess(node, capacity) {
+			continue
+		}
+		for _, topology := range topologies {
+			if capacity.Selector().Matches(topology) {
+				if found != nil {
+					return nil
+				}
+				found = capacity
+				break
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,166 @@
+package storagecapacityprioritization
+
+import (
+	"context"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
+)
+
+// CapacityReport is the capacity of a storage class on a node, and how the
+// plugin evaluates a claim of the requested size against it.
+type CapacityReport struct {
+	Node         string `json:"node"`
+	StorageClass string `json:"storageClass"`
+	// CSIStorageCapacities are the CSIStorageCapacity objects whose node
+	// topology matches the node, as "namespace/name".
+	CSIStorageCapacities []string `json:"csiStorageCapacities,omitempty"`
+	// Capacity is the sum of the capacities of the matching objects.
+	Capacity int64 `json:"capacity"`
+	// Available is the capacity available to the claim, aggregated by
+	// CapacityAggregation and adjusted by the policy of the storage class.
+	Available int64 `json:"available"`
+	// MaximumVolumeSize is the largest MaximumVolumeSize of the matching
+	// objects. 0 means it's not limited.
+	MaximumVolumeSize int64 `json:"maximumVolumeSize"`
+	// PendingDemand is the bytes requested by the pending claims of the
+	// storage class which are selected for the node and being provisioned.
+	PendingDemand int64 `json:"pendingDemand"`
+	// Feasible reports whether the claim passes Filter.
+	Feasible bool `json:"feasible"`
+	// Usage is the usage ratio of the claim which the score is calculated
+	// from, and Score is the score of the storage class, as PreScore does.
+	// They are zero when the claim doesn't pass Filter.
+	Usage float64 `json:"usage"`
+	Score float64 `json:"score"`
+}
+
+// ReportCapacities evaluates a claim of the requested size of every storage
+// class whose capacity is tracked, on every node of the objects, in the same
+// way as Filter and PreScore of the plugin do. See Simulate for the objects.
+// The reports are ordered by the node name and the storage class name.
+func ReportCapacities(ctx context.Context, args *config.StorageCapacityPrioritizationArgs, objects []runtime.Object, request int64) ([]*CapacityReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pl, nodeInfos, err := newSimulation(ctx, args, objects)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := pl.classLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	pvcs, err := pl.pvcLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make([]*v1.PersistentVolumeClaim, 0, len(classes))
+	for _, class := range classes {
+		claims = append(claims, &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "capacity-report-" + class.Name,
+				Namespace: metav1.NamespaceDefault,
+			},
+			Spec: v1.PersistentVolumeClaimSpec{
+				StorageClassName: &class.Name,
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceStorage: *resource.NewQuantity(request, resource.BinarySI),
+					},
+				},
+			},
+		})
+	}
+	capacities, err := pl.snapshotCapacities(claims)
+	if err != nil {
+		return nil, err
+	}
+	var classNames []string
+	claimsBySC := claimsByStorageClass{}
+	scorers := map[string]storagecapacity.ClassScorer{}
+	for i, class := range classes {
+		if classCapacities, ok := capacities[class.Name]; !ok || !classCapacities.Tracked {
+			continue
+		}
+		classNames = append(classNames, class.Name)
+		claimsBySC[class.Name] = claimGroup{claims[i]}
+		scorers[class.Name] = pl.scorers.Get(class)
+	}
+
+	nodes := make([]*v1.Node, 0, len(nodeInfos))
+	for _, nodeInfo := range nodeInfos {
+		nodes = append(nodes, nodeInfo.Node())
+	}
+	_, classScores, err := storagecapacity.CalculateScores(&pl.args, nodes, classNames, capacities, claimsBySC, scorers, pl.assumedCapacities.assumedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*CapacityReport
+	for _, node := range nodes {
+		for _, className := range classNames {
+			report := &CapacityReport{Node: node.Name, StorageClass: className}
+			unlimited := false
+			for _, capacity := range capacities[className].Capacities {
+				if capacity.Capacity == nil || !storagecapacity.NodeHasAccess(node, capacity) {
+					continue
+				}
+				report.CSIStorageCapacities = append(report.CSIStorageCapacities, capacity.Namespace+"/"+capacity.Name)
+				report.Capacity += capacity.Capacity.Value()
+				if capacity.MaximumVolumeSize == nil {
+					unlimited = true
+				} else if capacity.MaximumVolumeSize.Value() > report.MaximumVolumeSize {
+					report.MaximumVolumeSize = capacity.MaximumVolumeSize.Value()
+				}
+			}
+			if unlimited {
+				report.MaximumVolumeSize = 0
+			}
+			for _, pvc := range pvcs {
+				if pvc.Status.Phase != v1.ClaimPending || storagecapacity.StorageClassName(pvc) != className || pvc.Annotations[pvutil.AnnSelectedNode] != node.Name {
+					continue
+				}
+				size := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+				report.PendingDemand += size.Value()
+			}
+
+			selection, reason, err := pl.findCapacity(node, className, claimsBySC[className], capacities, pl.assumedCapacities.assumedBytes)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case reason != nil:
+				report.Available = reason.Available
+			case selection != nil:
+				report.Feasible = true
+				report.Available = selection.Available
+			default:
+				// No object covers the node, and UnknownCapacity allows it.
+				report.Feasible = true
+			}
+			if report.Feasible {
+				for _, sc := range classScores[node.Name] {
+					if sc.StorageClassName == className {
+						report.Usage = sc.Usage
+						report.Score = sc.Score
+					}
+				}
+			}
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
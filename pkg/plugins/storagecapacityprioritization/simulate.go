@@ -0,0 +1,192 @@
+package storagecapacityprioritization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+// NodeSimulation is the result of a node in Simulate.
+type NodeSimulation struct {
+	Node string `json:"node"`
+	// Feasible reports whether the node passes Filter.
+	Feasible bool `json:"feasible"`
+	// Reasons are the reasons why the node is rejected.
+	Reasons []string `json:"reasons,omitempty"`
+	// Score is the score of the node after NormalizeScore. It's only set
+	// for the feasible nodes.
+	Score *int64 `json:"score,omitempty"`
+}
+
+// Simulate runs PreFilter, Filter, PreScore, Score and NormalizeScore of the
+// plugin for the pod against the objects, without an API server. The objects
+// are the Nodes, StorageClasses, CSIDrivers, v1beta1 CSIStorageCapacities,
+// PersistentVolumeClaims, PersistentVolumes and Pods the plugin reads.
+// The Pods with a node name are added to the nodes.
+// It returns the results of all the nodes ordered by the name.
+func Simulate(ctx context.Context, args *config.StorageCapacityPrioritizationArgs, objects []runtime.Object, pod *v1.Pod) ([]*NodeSimulation, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pl, nodeInfos, err := newSimulation(ctx, args, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*NodeSimulation, 0, len(nodeInfos))
+	for _, nodeInfo := range nodeInfos {
+		results = append(results, &NodeSimulation{Node: nodeInfo.Node().Name})
+	}
+	state := framework.NewCycleState()
+	if status := pl.PreFilter(ctx, state, pod); !status.IsSuccess() {
+		if status.Code() == framework.Error {
+			return nil, status.AsError()
+		}
+		for _, result := range results {
+			result.Reasons = status.Reasons()
+		}
+		return results, nil
+	}
+
+	var feasibleNodes []*v1.Node
+	for i, nodeInfo := range nodeInfos {
+		status := pl.Filter(ctx, state, pod, nodeInfo)
+		if status.Code() == framework.Error {
+			return nil, status.AsError()
+		}
+		if !status.IsSuccess() {
+			results[i].Reasons = status.Reasons()
+			continue
+		}
+		results[i].Feasible = true
+		feasibleNodes = append(feasibleNodes, nodeInfo.Node())
+	}
+	if len(feasibleNodes) == 0 {
+		return results, nil
+	}
+
+	if status := pl.PreScore(ctx, state, pod, feasibleNodes); !status.IsSuccess() {
+		return nil, status.AsError()
+	}
+	scores := make(framework.NodeScoreList, 0, len(feasibleNodes))
+	for _, node := range feasibleNodes {
+		score, status := pl.Score(ctx, state, pod, node.Name)
+		if !status.IsSuccess() {
+			return nil, status.AsError()
+		}
+		scores = append(scores, framework.NodeScore{Name: node.Name, Score: score})
+	}
+	if ext := pl.ScoreExtensions(); ext != nil {
+		if status := ext.NormalizeScore(ctx, state, pod, scores); !status.IsSuccess() {
+			return nil, status.AsError()
+		}
+	}
+	byName := make(map[string]*NodeSimulation, len(results))
+	for _, result := range results {
+		byName[result.Node] = result
+	}
+	for _, score := range scores {
+		s := score.Score
+		byName[score.Name].Score = &s
+	}
+	return results, nil
+}
+
+// newSimulation returns the plugin reading the objects from a fake clientset,
+// and the node infos of all the nodes. The informers are stopped when the
+// context is canceled.
+func newSimulation(ctx context.Context, args *config.StorageCapacityPrioritizationArgs, objects []runtime.Object) (*StorageCapacityPrioritization, []*framework.NodeInfo, error) {
+	client := fake.NewSimpleClientset(objects...)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	fh, err := frameworkruntime.NewFramework(nil, nil,
+		frameworkruntime.WithClientSet(client),
+		frameworkruntime.WithInformerFactory(informerFactory),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := NewFactory(ctx)(args, fh)
+	if err != nil {
+		return nil, nil, err
+	}
+	pl := p.(*StorageCapacityPrioritization)
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	nodeInfos, err := simulationNodeInfos(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	pl.sharedLister = nodeInfoLister(nodeInfos)
+	return pl, nodeInfos, nil
+}
+
+// simulationNodeInfos returns the node infos of all the nodes with the pods
+// assigned to them, ordered by the name.
+func simulationNodeInfos(ctx context.Context, client *fake.Clientset) ([]*framework.NodeInfo, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeInfos := make([]*framework.NodeInfo, 0, len(nodes.Items))
+	byName := make(map[string]*framework.NodeInfo, len(nodes.Items))
+	for i := range nodes.Items {
+		nodeInfo := framework.NewNodeInfo()
+		nodeInfo.SetNode(&nodes.Items[i])
+		nodeInfos = append(nodeInfos, nodeInfo)
+		byName[nodes.Items[i].Name] = nodeInfo
+	}
+	for i := range pods.Items {
+		if nodeInfo, ok := byName[pods.Items[i].Spec.NodeName]; ok {
+			nodeInfo.AddPod(&pods.Items[i])
+		}
+	}
+	sort.Slice(nodeInfos, func(i, j int) bool {
+		return nodeInfos[i].Node().Name < nodeInfos[j].Node().Name
+	})
+	return nodeInfos, nil
+}
+
+// nodeInfoLister lists the node infos given without a scheduler cache.
+type nodeInfoLister []*framework.NodeInfo
+
+var _ framework.SharedLister = nodeInfoLister{}
+
+func (l nodeInfoLister) NodeInfos() framework.NodeInfoLister {
+	return l
+}
+
+func (l nodeInfoLister) List() ([]*framework.NodeInfo, error) {
+	return l, nil
+}
+
+func (l nodeInfoLister) HavePodsWithAffinityList() ([]*framework.NodeInfo, error) {
+	return nil, nil
+}
+
+func (l nodeInfoLister) HavePodsWithRequiredAntiAffinityList() ([]*framework.NodeInfo, error) {
+	return nil, nil
+}
+
+func (l nodeInfoLister) Get(nodeName string) (*framework.NodeInfo, error) {
+	for _, nodeInfo := range l {
+		if nodeInfo.Node().Name == nodeName {
+			return nodeInfo, nil
+		}
+	}
+	return nil, fmt.Errorf("node %q not found", nodeName)
+}
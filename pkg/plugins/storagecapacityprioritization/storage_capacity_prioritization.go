@@ -5,24 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/storage/v1beta1"
-	storagev1beta1 "k8s.io/api/storage/v1beta1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
 	storagelisters "k8s.io/client-go/listers/storage/v1"
-	storagelistersv1beta1 "k8s.io/client-go/listers/storage/v1beta1"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/klog/v2"
+	schedconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
-	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumebinding"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
 
 	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
 )
 
 const (
@@ -30,30 +31,96 @@ const (
 	stateKey framework.StateKey = Name
 )
 
-type claimGroup []*v1.PersistentVolumeClaim
-
-func (cg *claimGroup) totalRequiredCapacity() (int64, error) {
-	total := resource.Quantity{}
-	for _, claim := range *cg {
-		quantity, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
-		if !ok {
-			return 0, fmt.Errorf("claim %s/%s does't have a resource request", claim.GetName(), claim.GetNamespace())
-		}
-		total.Add(quantity)
-	}
-	return total.Value(), nil
-}
-
-type claimsByStorageClass map[string]claimGroup
-
 type stateData struct {
+	// claimsToBind are the unbound claims of the pod with delayed binding.
+	claimsToBind []*v1.PersistentVolumeClaim
+	// pvs are the PersistentVolumes which the claims may be bound to, listed
+	// once per scheduling cycle. The ones assumed for the reserved pods are
+	// excluded.
+	pvs []*v1.PersistentVolume
+	// capacities is the snapshot of the CSIStorageCapacity objects of the
+	// storage classes of claimsToBind.
+	capacities        map[string]*storageClassCapacities
 	storageClassNames sets.String
 	scores            map[string]int64
+	// rawScores are the scores before truncated to integers. They are only
+	// kept when the scores are normalized in NormalizeScore.
+	rawScores map[string]float64
+	// normalizedScores are the scores after NormalizeScore. They are only
+	// kept when the scores are normalized and explained in PostBind.
+	normalizedScores map[string]int64
+	// rejections summarizes the nodes rejected by Filter per storage class.
+	rejections map[string]*storageClassRejections
+	// classScores are the scores of the storage classes on every node. They
+	// are only kept when the scores are explained in PostBind.
+	classScores map[string][]*classScore
+	// index is the CSIStorageCapacity objects which may be enough for the
+	// claims, built in PreFilter. It's nil when the nodes are not narrowed
+	// down.
+	index *capacityIndex
 	sync.Mutex
 }
 
+// Clone returns a copy of the state data whose results of Filter and the
+// scoring are independent of d, so that the dry runs of Filter on a cloned
+// cycle state, e.g. during preemption, don't change them. The claims, the
+// PersistentVolumes and the capacities found in PreFilter are not modified
+// after PreFilter, so they are shared.
 func (d *stateData) Clone() framework.StateData {
-	return d
+	d.Lock()
+	defer d.Unlock()
+	clone := &stateData{
+		claimsToBind:      d.claimsToBind,
+		pvs:               d.pvs,
+		capacities:        d.capacities,
+		storageClassNames: sets.NewString(d.storageClassNames.UnsortedList()...),
+		index:             d.index,
+	}
+	if d.scores != nil {
+		clone.scores = make(map[string]int64, len(d.scores))
+		for name, score := range d.scores {
+			clone.scores[name] = score
+		}
+	}
+	if d.rawScores != nil {
+		clone.rawScores = make(map[string]float64, len(d.rawScores))
+		for name, score := range d.rawScores {
+			clone.rawScores[name] = score
+		}
+	}
+	if d.normalizedScores != nil {
+		clone.normalizedScores = make(map[string]int64, len(d.normalizedScores))
+		for name, score := range d.normalizedScores {
+			clone.normalizedScores[name] = score
+		}
+	}
+	if d.rejections != nil {
+		clone.rejections = make(map[string]*storageClassRejections, len(d.rejections))
+		for className, r := range d.rejections {
+			copied := *r
+			clone.rejections[className] = &copied
+		}
+	}
+	if d.classScores != nil {
+		clone.classScores = make(map[string][]*classScore, len(d.classScores))
+		for name, scores := range d.classScores {
+			clone.classScores[name] = scores
+		}
+	}
+	return clone
+}
+
+// reject records the reasons why the node is rejected, and returns the status
+// of Filter with them.
+func (d *stateData) reject(reasons []*filterReason) *framework.Status {
+	d.Lock()
+	defer d.Unlock()
+	status := framework.NewStatus(framework.UnschedulableAndUnresolvable)
+	for _, reason := range reasons {
+		d.recordRejection(reason)
+		status.AppendReason(reason.Message)
+	}
+	return status
 }
 
 func getStateData(cs *framework.CycleState) (*stateData, error) {
@@ -70,10 +137,143 @@ func getStateData(cs *framework.CycleState) (*stateData, error) {
 
 func validateStorageCapacityPrioritizationArgs(path *field.Path, args *config.StorageCapacityPrioritizationArgs) error {
 	var allErrs field.ErrorList
+	if args.ScoringStrategy != nil {
+		allErrs = append(allErrs, validateScoringStrategy(path.Child("scoringStrategy"), args.ScoringStrategy)...)
+	}
+	allErrs = append(allErrs, validateStorageClassPolicies(path.Child("storageClasses"), args.StorageClasses)...)
+	switch args.CapacityAggregation {
+	case "", config.MaxCapacityAggregation, config.SumCapacityAggregation, config.BestFitCapacityAggregation, config.PackCapacityAggregation:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("capacityAggregation"), args.CapacityAggregation, []string{string(config.MaxCapacityAggregation), string(config.SumCapacityAggregation), string(config.BestFitCapacityAggregation), string(config.PackCapacityAggregation)}))
+	}
+	switch args.ScoreNormalization {
+	case "", config.NoneScoreNormalization, config.MinMaxScoreNormalization, config.RankScoreNormalization:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("scoreNormalization"), args.ScoreNormalization, []string{string(config.NoneScoreNormalization), string(config.MinMaxScoreNormalization), string(config.RankScoreNormalization)}))
+	}
+	if args.ScoreExplanationNodes < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("scoreExplanationNodes"), args.ScoreExplanationNodes, "must be greater than or equal to 0"))
+	}
+	switch args.UnknownCapacity {
+	case "", config.NeutralUnknownCapacity, config.ZeroUnknownCapacity, config.MaxUnknownCapacity, config.RejectUnknownCapacity:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("unknownCapacity"), args.UnknownCapacity, []string{string(config.NeutralUnknownCapacity), string(config.ZeroUnknownCapacity), string(config.MaxUnknownCapacity), string(config.RejectUnknownCapacity)}))
+	}
 	return allErrs.ToAggregate()
 }
 
+func validateStorageClassPolicies(path *field.Path, policies []config.StorageClassPolicy) field.ErrorList {
+	var allErrs field.ErrorList
+	seenClassNames := sets.NewString()
+	seenProvisioners := sets.NewString()
+	for i, policy := range policies {
+		p := path.Index(i)
+		switch {
+		case policy.StorageClassName != "" && policy.Provisioner != "":
+			allErrs = append(allErrs, field.Invalid(p, policy.Provisioner, "only one of storageClassName and provisioner can be specified"))
+		case policy.StorageClassName != "":
+			if seenClassNames.Has(policy.StorageClassName) {
+				allErrs = append(allErrs, field.Duplicate(p.Child("storageClassName"), policy.StorageClassName))
+			}
+			seenClassNames.Insert(policy.StorageClassName)
+		case policy.Provisioner != "":
+			if seenProvisioners.Has(policy.Provisioner) {
+				allErrs = append(allErrs, field.Duplicate(p.Child("provisioner"), policy.Provisioner))
+			}
+			seenProvisioners.Insert(policy.Provisioner)
+		default:
+			allErrs = append(allErrs, field.Required(p, "either storageClassName or provisioner must be specified"))
+		}
+		if policy.Weight != nil && (*policy.Weight < 0 || *policy.Weight > 100) {
+			allErrs = append(allErrs, field.Invalid(p.Child("weight"), *policy.Weight, "not in valid range [0, 100]"))
+		}
+		if policy.ScoringStrategy != nil {
+			allErrs = append(allErrs, validateScoringStrategy(p.Child("scoringStrategy"), policy.ScoringStrategy)...)
+		}
+		if policy.ReservedCapacity != nil && policy.ReservedCapacity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(p.Child("reservedCapacity"), policy.ReservedCapacity.String(), "must be greater than or equal to 0"))
+		}
+		if policy.ReservedCapacityPercentage < 0 || policy.ReservedCapacityPercentage > 100 {
+			allErrs = append(allErrs, field.Invalid(p.Child("reservedCapacityPercentage"), policy.ReservedCapacityPercentage, "not in valid range [0, 100]"))
+		}
+		if policy.OvercommitPercentage != 0 && policy.OvercommitPercentage < 100 {
+			allErrs = append(allErrs, field.Invalid(p.Child("overcommitPercentage"), policy.OvercommitPercentage, "must be 0 or greater than or equal to 100"))
+		}
+		if policy.MaxUsedCapacityPercentage < 0 || policy.MaxUsedCapacityPercentage > 100 {
+			allErrs = append(allErrs, field.Invalid(p.Child("maxUsedCapacityPercentage"), policy.MaxUsedCapacityPercentage, "not in valid range [0, 100]"))
+		}
+	}
+	return allErrs
+}
+
+func validateScoringStrategy(path *field.Path, strategy *config.ScoringStrategy) field.ErrorList {
+	var allErrs field.ErrorList
+	switch strategy.Type {
+	case config.MostAllocated, config.LeastAllocated:
+		if strategy.RequestedToCapacityRatio != nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("requestedToCapacityRatio"), fmt.Sprintf("only allowed for scoring strategy %q", config.RequestedToCapacityRatio)))
+		}
+	case config.RequestedToCapacityRatio:
+		if strategy.RequestedToCapacityRatio == nil {
+			allErrs = append(allErrs, field.Required(path.Child("requestedToCapacityRatio"), fmt.Sprintf("required for scoring strategy %q", config.RequestedToCapacityRatio)))
+		} else {
+			allErrs = append(allErrs, validateFunctionShape(path.Child("requestedToCapacityRatio", "shape"), strategy.RequestedToCapacityRatio.Shape)...)
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("type"), strategy.Type, []string{string(config.MostAllocated), string(config.LeastAllocated), string(config.RequestedToCapacityRatio)}))
+	}
+	return allErrs
+}
+
+func validateFunctionShape(path *field.Path, shape []config.UtilizationShapePoint) field.ErrorList {
+	const (
+		minUtilization = 0
+		maxUtilization = 100
+		minScore       = 0
+		maxScore       = int32(schedconfig.MaxCustomPriorityScore)
+	)
+
+	var allErrs field.ErrorList
+	if len(shape) == 0 {
+		allErrs = append(allErrs, field.Required(path, "at least one point must be specified"))
+		return allErrs
+	}
+
+	for i := 1; i < len(shape); i++ {
+		if shape[i-1].Utilization >= shape[i].Utilization {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("utilization"), shape[i].Utilization, "utilization values must be sorted in increasing order"))
+			break
+		}
+	}
+
+	for i, point := range shape {
+		if point.Utilization < minUtilization || point.Utilization > maxUtilization {
+			msg := fmt.Sprintf("not in valid range [%d, %d]", minUtilization, maxUtilization)
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("utilization"), point.Utilization, msg))
+		}
+		if point.Score < minScore || point.Score > maxScore {
+			msg := fmt.Sprintf("not in valid range [%d, %d]", minScore, maxScore)
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("score"), point.Score, msg))
+		}
+	}
+	return allErrs
+}
+
+// New initializes the plugin. The informers started by the plugin run until
+// the process exits; use NewFactory to stop them with the scheduler.
 func New(plArgs runtime.Object, handle framework.Handle) (framework.Plugin, error) {
+	return newPlugin(context.Background(), plArgs, handle)
+}
+
+// NewFactory returns the factory of the plugin whose informers are stopped
+// when the context is canceled.
+func NewFactory(ctx context.Context) frameworkruntime.PluginFactory {
+	return func(plArgs runtime.Object, handle framework.Handle) (framework.Plugin, error) {
+		return newPlugin(ctx, plArgs, handle)
+	}
+}
+
+func newPlugin(ctx context.Context, plArgs runtime.Object, handle framework.Handle) (framework.Plugin, error) {
 	args, err := getArgs(plArgs)
 	if err != nil {
 		return nil, err
@@ -81,12 +281,37 @@ func New(plArgs runtime.Object, handle framework.Handle) (framework.Plugin, erro
 	if err := validateStorageCapacityPrioritizationArgs(nil, &args); err != nil {
 		return nil, err
 	}
+	registerMetrics()
+	scorers, err := storagecapacity.NewClassScorers(&args)
+	if err != nil {
+		return nil, err
+	}
+	capacityLister, err := newCSIStorageCapacityLister(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
 
+	pvcLister := handle.SharedInformerFactory().Core().V1().PersistentVolumeClaims().Lister()
+	var pdbLister policylisters.PodDisruptionBudgetLister
+	if args.EnablePreemption {
+		pdbLister = handle.SharedInformerFactory().Policy().V1().PodDisruptionBudgets().Lister()
+	}
 	return &StorageCapacityPrioritization{
 		args:                     args,
+		scorers:                  scorers,
+		assumedCapacities:        newAssumedCapacityCache(pvcLister),
+		assumedVolumes:           newAssumedVolumeCache(),
+		nodeLister:               handle.SharedInformerFactory().Core().V1().Nodes().Lister(),
+		pvcLister:                pvcLister,
+		pvLister:                 handle.SharedInformerFactory().Core().V1().PersistentVolumes().Lister(),
 		classLister:              handle.SharedInformerFactory().Storage().V1().StorageClasses().Lister(),
 		csiDriverLister:          handle.SharedInformerFactory().Storage().V1().CSIDrivers().Lister(),
-		csiStorageCapacityLister: handle.SharedInformerFactory().Storage().V1beta1().CSIStorageCapacities().Lister(),
+		csiStorageCapacityLister: capacityLister,
+		eventRecorder:            handle.EventRecorder(),
+		clientSet:                handle.ClientSet(),
+		sharedLister:             handle.SnapshotSharedLister(),
+		pdbLister:                pdbLister,
+		handle:                   handle,
 	}, nil
 }
 
@@ -104,14 +329,31 @@ func getArgs(obj runtime.Object) (config.StorageCapacityPrioritizationArgs, erro
 
 type StorageCapacityPrioritization struct {
 	args                     config.StorageCapacityPrioritizationArgs
+	scorers                  *storagecapacity.ClassScorers
+	assumedCapacities        *assumedCapacityCache
+	assumedVolumes           *assumedVolumeCache
+	nodeLister               corelisters.NodeLister
+	pvcLister                corelisters.PersistentVolumeClaimLister
+	pvLister                 corelisters.PersistentVolumeLister
 	classLister              storagelisters.StorageClassLister
 	csiDriverLister          storagelisters.CSIDriverLister
-	csiStorageCapacityLister storagelistersv1beta1.CSIStorageCapacityLister
+	csiStorageCapacityLister csiStorageCapacityLister
+	eventRecorder            events.EventRecorder
+	clientSet                clientset.Interface
+	sharedLister             framework.SharedLister
+	// pdbLister is only set when EnablePreemption is set.
+	pdbLister policylisters.PodDisruptionBudgetLister
+	handle    framework.Handle
 }
 
+var _ framework.PreFilterExtensions = &StorageCapacityPrioritization{}
 var _ framework.FilterPlugin = &StorageCapacityPrioritization{}
+var _ framework.PostFilterPlugin = &StorageCapacityPrioritization{}
 var _ framework.PreScorePlugin = &StorageCapacityPrioritization{}
 var _ framework.ScorePlugin = &StorageCapacityPrioritization{}
+var _ framework.ScoreExtensions = &StorageCapacityPrioritization{}
+var _ framework.ReservePlugin = &StorageCapacityPrioritization{}
+var _ framework.PostBindPlugin = &StorageCapacityPrioritization{}
 var _ framework.EnqueueExtensions = &StorageCapacityPrioritization{}
 
 func (pl *StorageCapacityPrioritization) Name() string {
@@ -138,18 +380,42 @@ func (pl *StorageCapacityPrioritization) EventsToRegister() []framework.ClusterE
 	}
 }
 
-// PreFilter invoked at the prefilter extension point to check if pod has all
-// immediate PVCs bound. If not all immediate PVCs are bound, an
+// PreFilter invoked at the prefilter extension point to find the unbound
+// claims of the pod with delayed binding. If the claims can't be found, an
 // UnschedulableAndUnresolvable is returned.
 func (pl *StorageCapacityPrioritization) PreFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod) *framework.Status {
+	claimsToBind, err := pl.getClaimsToBind(pod)
+	if err != nil {
+		return framework.NewStatus(framework.UnschedulableAndUnresolvable, err.Error())
+	}
+	var pvs []*v1.PersistentVolume
+	var capacities map[string]*storageClassCapacities
+	var index *capacityIndex
+	if len(claimsToBind) > 0 {
+		pvs, err = pl.listPersistentVolumes()
+		if err != nil {
+			return framework.AsStatus(err)
+		}
+		start := time.Now()
+		capacities, err = pl.snapshotCapacities(claimsToBind)
+		if err != nil {
+			return framework.AsStatus(err)
+		}
+		capacityLookupDuration.Observe(time.Since(start).Seconds())
+
+		index, err = pl.newCapacityIndex(claimsToBind, pvs, capacities)
+		if err != nil {
+			return framework.AsStatus(err)
+		}
+	}
 	// initialize state data
-	state.Write(stateKey, &stateData{storageClassNames: sets.NewString()})
+	state.Write(stateKey, &stateData{claimsToBind: claimsToBind, pvs: pvs, capacities: capacities, storageClassNames: sets.NewString(), index: index})
 	return nil
 }
 
 // PreFilterExtensions returns prefilter extensions, pod add and remove.
 func (pl *StorageCapacityPrioritization) PreFilterExtensions() framework.PreFilterExtensions {
-	return nil
+	return pl
 }
 
 func (pl *StorageCapacityPrioritization) Filter(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
@@ -157,34 +423,42 @@ func (pl *StorageCapacityPrioritization) Filter(ctx context.Context, cs *framewo
 	if node == nil {
 		return framework.NewStatus(framework.Error, "node not found")
 	}
-	vbstate, err := volumebinding.GetStateData(cs)
+	state, err := getStateData(cs)
 	if err != nil {
-		return framework.AsStatus(fmt.Errorf("failed to get VolumeBinding state data: %s", err.Error()))
+		return framework.AsStatus(err)
 	}
-	podVolume := vbstate.GetPodVolumesByNodeName(node.GetName())
-	if podVolume == nil {
+	if len(state.claimsToBind) == 0 {
 		return nil
 	}
-	claims, err := pl.claimsByStorageClass(podVolume.DynamicProvisions)
+	if hopeless := state.index.hopelessClaims(node); len(hopeless) > 0 {
+		// The storage classes are evaluated first without finding the
+		// PersistentVolumes for the claims, since none can be bound to them.
+		// The index doesn't count the capacity freed by the pods removed
+		// from the node, so the node may pass.
+		reasons, err := pl.hasEnoughCapacities(hopeless, node, state.capacities, pl.assumedFunc(cs))
+		if err != nil {
+			return framework.AsStatus(err)
+		}
+		if len(reasons) > 0 {
+			return state.reject(reasons)
+		}
+	}
+	claimsToProvision, _, err := pl.getClaimsToProvision(state.claimsToBind, state.pvs, node)
 	if err != nil {
 		return framework.AsStatus(err)
 	}
-
-	reasons, err := pl.hasEnoughCapacities(claims, node)
+	claims, err := pl.claimsByStorageClass(claimsToProvision)
 	if err != nil {
 		return framework.AsStatus(err)
 	}
-	if len(reasons) > 0 {
-		status := framework.NewStatus(framework.UnschedulableAndUnresolvable)
-		for _, reason := range reasons {
-			status.AppendReason(string(reason))
-		}
-		return status
-	}
-	state, err := getStateData(cs)
+
+	reasons, err := pl.hasEnoughCapacities(claims, node, state.capacities, pl.assumedFunc(cs))
 	if err != nil {
 		return framework.AsStatus(err)
 	}
+	if len(reasons) > 0 {
+		return state.reject(reasons)
+	}
 	state.Lock()
 	defer state.Unlock()
 	for sc := range claims {
@@ -193,39 +467,109 @@ func (pl *StorageCapacityPrioritization) Filter(ctx context.Context, cs *framewo
 	return nil
 }
 
-func (pl *StorageCapacityPrioritization) PreScore(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) *framework.Status {
-	vbstate, err := volumebinding.GetStateData(cs)
+// PostFilter is invoked when no node fits the pod. It emits the events which
+// summarize the nodes rejected by Filter, and preempts the lower priority pods
+// to free the capacity when EnablePreemption is set.
+// It returns Unschedulable when no pod is preempted, so that the following
+// PostFilter plugins run.
+func (pl *StorageCapacityPrioritization) PostFilter(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, filteredNodeStatusMap framework.NodeToStatusMap) (*framework.PostFilterResult, *framework.Status) {
+	state, err := getStateData(cs)
 	if err != nil {
-		return framework.AsStatus(fmt.Errorf("failed to get VolumeBinding state data: %s", err.Error()))
+		return nil, framework.NewStatus(framework.Unschedulable)
 	}
-	claims := vbstate.GetClaimsToBind()
-	if len(claims) == 0 {
-		return nil
+	pl.emitRejectionEvents(pod, state)
+	if !pl.args.EnablePreemption {
+		return nil, framework.NewStatus(framework.Unschedulable)
 	}
-	claimsBySC, err := pl.claimsByStorageClass(claims)
+
+	nodeName, err := pl.preempt(ctx, cs, state, pod, filteredNodeStatusMap)
 	if err != nil {
-		framework.AsStatus(err)
+		return nil, framework.AsStatus(err)
+	}
+	if nodeName == "" {
+		return nil, framework.NewStatus(framework.Unschedulable, "no lower priority pods free enough capacity")
 	}
+	return framework.NewPostFilterResultWithNominatedNode(nodeName), framework.NewStatus(framework.Success)
+}
 
+func (pl *StorageCapacityPrioritization) PreScore(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) *framework.Status {
 	state, err := getStateData(cs)
 	if err != nil {
 		return framework.AsStatus(fmt.Errorf("failed to get state data: %s", err.Error()))
 	}
+	if len(state.claimsToBind) == 0 {
+		return nil
+	}
+	claimsBySC, err := pl.claimsByStorageClass(state.claimsToBind)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
 
-	capacities, err := pl.csiStorageCapacityLister.List(labels.Everything())
-	if err != nil && !apierrors.IsNotFound(err) {
-		return framework.AsStatus(fmt.Errorf("failed to find csi storage capacities err=%v", err))
+	scorers := make(map[string]storagecapacity.ClassScorer, len(claimsBySC))
+	for className := range claimsBySC {
+		class, err := pl.classLister.Get(className)
+		if err != nil {
+			return framework.AsStatus(fmt.Errorf("failed to find storage class %q", className))
+		}
+		scorers[className] = pl.scorers.Get(class)
 	}
 
-	scores, err := calculateScore(nodes, state.storageClassNames.List(), capacities, claimsBySC)
+	rawScores, classScores, err := storagecapacity.CalculateScores(&pl.args, nodes, state.storageClassNames.List(), state.capacities, claimsBySC, scorers, pl.assumedCapacities.assumedBytes)
 	if err != nil {
 		return framework.AsStatus(fmt.Errorf("failed to calcurate scores: %s", err.Error()))
 	}
+	scores := make(map[string]int64, len(rawScores))
+	for nodeName, rawScore := range rawScores {
+		scores[nodeName] = int64(rawScore)
+		nodeScores.Observe(float64(scores[nodeName]))
+	}
 	state.scores = scores
+	if pl.normalizesScore() {
+		state.rawScores = rawScores
+	}
+	if pl.args.ScoreExplanationNodes > 0 {
+		state.classScores = classScores
+	}
 	return nil
 }
 
+// ScoreExtensions returns the plugin itself only when the scores are
+// normalized, so that the framework doesn't call NormalizeScore otherwise.
 func (pl *StorageCapacityPrioritization) ScoreExtensions() framework.ScoreExtensions {
+	if !pl.normalizesScore() {
+		return nil
+	}
+	return pl
+}
+
+func (pl *StorageCapacityPrioritization) normalizesScore() bool {
+	return pl.args.ScoreNormalization != "" && pl.args.ScoreNormalization != config.NoneScoreNormalization
+}
+
+// NormalizeScore rescales the scores of the nodes to the range of
+// [0, MaxNodeScore] from the raw scores calculated in PreScore.
+// The nodes which have no raw score, because no capacity of the claims is
+// found on them, are left as they are.
+func (pl *StorageCapacityPrioritization) NormalizeScore(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, scores framework.NodeScoreList) *framework.Status {
+	state, err := getStateData(cs)
+	if err != nil {
+		return framework.AsStatus(fmt.Errorf("failed to get state data: %s", err.Error()))
+	}
+	if len(state.rawScores) == 0 {
+		return nil
+	}
+	switch pl.args.ScoreNormalization {
+	case config.MinMaxScoreNormalization:
+		normalizeMinMax(scores, state.rawScores)
+	case config.RankScoreNormalization:
+		normalizeRank(scores, state.rawScores)
+	}
+	if pl.args.ScoreExplanationNodes > 0 {
+		state.normalizedScores = make(map[string]int64, len(scores))
+		for _, score := range scores {
+			state.normalizedScores[score.Name] = score.Score
+		}
+	}
 	return nil
 }
 
@@ -242,139 +586,100 @@ func (pl *StorageCapacityPrioritization) Score(ctx context.Context, cs *framewor
 	return 0, nil
 }
 
+// Reserve assumes the capacity consumed by the claims provisioned on the node
+// so that the following scheduling cycles don't place more volumes than the
+// capacity until the CSIStorageCapacity objects are refreshed. It also assumes
+// the PersistentVolumes matched to the other claims so that they are not
+// matched to the claims of the following pods until they are bound.
+func (pl *StorageCapacityPrioritization) Reserve(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	state, err := getStateData(cs)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	if len(state.claimsToBind) == 0 {
+		return nil
+	}
+	node, err := pl.nodeLister.Get(nodeName)
+	if err != nil {
+		return framework.AsStatus(fmt.Errorf("failed to find node %q: %s", nodeName, err.Error()))
+	}
+	claimsToProvision, matchedPVs, err := pl.getClaimsToProvision(state.claimsToBind, state.pvs, node)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	claims, err := pl.claimsByStorageClass(claimsToProvision)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+
+	pl.assumedVolumes.assume(pod.UID, matchedPVs)
+	for className, cg := range claims {
+		selection, _, err := pl.findCapacity(node, className, cg, state.capacities, pl.assumedCapacities.assumedBytes)
+		if err != nil {
+			pl.forget(pod.UID)
+			return framework.AsStatus(err)
+		}
+		if selection == nil {
+			continue
+		}
+		for _, allocation := range selection.Allocations {
+			if err := pl.assumedCapacities.assume(pod.UID, allocation.Capacity, cg, allocation.Bytes); err != nil {
+				pl.forget(pod.UID)
+				return framework.AsStatus(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Unreserve forgets the capacity and the PersistentVolumes assumed by the pod.
+// It's idempotent, and does nothing if nothing is assumed for the given pod.
+func (pl *StorageCapacityPrioritization) Unreserve(ctx context.Context, cs *framework.CycleState, pod *v1.Pod, nodeName string) {
+	pl.forget(pod.UID)
+}
+
+func (pl *StorageCapacityPrioritization) forget(podUID types.UID) {
+	pl.assumedCapacities.forget(podUID)
+	pl.assumedVolumes.forget(podUID)
+}
+
 func (pl *StorageCapacityPrioritization) claimsByStorageClass(claimsToProvision []*v1.PersistentVolumeClaim) (claimsByStorageClass, error) {
-	claims := claimsByStorageClass{}
 	for _, claim := range claimsToProvision {
 		className := *claim.Spec.StorageClassName
 		_, err := pl.classLister.Get(className)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find storage class %q", className)
 		}
-		if _, ok := claims[className]; !ok {
-			claims[className] = []*v1.PersistentVolumeClaim{}
-		}
-		claims[className] = append(claims[className], claim)
 	}
-	return claims, nil
+	return storagecapacity.GroupByStorageClass(claimsToProvision), nil
 }
 
-func (pl *StorageCapacityPrioritization) hasEnoughCapacities(csc claimsByStorageClass, node *v1.Node) ([]string, error) {
-	var reasons []string
+func (pl *StorageCapacityPrioritization) hasEnoughCapacities(csc claimsByStorageClass, node *v1.Node, capacities map[string]*storageClassCapacities, assumed storagecapacity.AssumedFunc) ([]*filterReason, error) {
+	var reasons []*filterReason
 	for className, cg := range csc {
-		reason, err := pl.hasEnoughCapacity(node, className, cg)
+		reason, err := pl.hasEnoughCapacity(node, className, cg, capacities, assumed)
 		if err != nil {
 			return nil, err
 		}
-		if reason != "" {
+		if reason != nil {
 			reasons = append(reasons, reason)
 		}
 	}
 	return reasons, nil
 }
 
-func (pl *StorageCapacityPrioritization) hasEnoughCapacity(node *v1.Node, className string, cg claimGroup) (string, error) {
-	class, err := pl.classLister.Get(className)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return fmt.Sprintf("storage class %q is not found", className), nil
-		}
-		return "", fmt.Errorf("failed to find storage class %q err=%v", className, err)
-	}
-
-	driver, err := pl.csiDriverLister.Get(class.Provisioner)
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return "", nil
-		}
-		return "", fmt.Errorf("failed to find csi driver object %q err=%v", class.Provisioner, err)
-	}
-	if driver.Spec.StorageCapacity == nil || !*driver.Spec.StorageCapacity {
-		return "", nil
-	}
-
-	capacities, err := pl.csiStorageCapacityLister.List(labels.Everything())
-	if err != nil && !apierrors.IsNotFound(err) {
-		return "", fmt.Errorf("failed to find csi storage capacities err=%v", err)
-	}
-
-	sizeInBytes, err := cg.totalRequiredCapacity()
-	if err != nil {
-		return "", err
-	}
-
-	for _, capacity := range capacities {
-		if capacity.StorageClassName == className &&
-			capacitySufficient(capacity, sizeInBytes) &&
-			nodeHasAccess(node, capacity) {
-			// Enough capacity found.
-			return "", nil
-		}
-	}
-	return fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", node.GetName(), sizeInBytes), nil
-}
-
-func calculateScore(nodes []*v1.Node, storageClassNames []string, capacities []*v1beta1.CSIStorageCapacity, claims claimsByStorageClass) (map[string]int64, error) {
-	capacityUsageMap := make(map[string]map[string]int64) // map[nodeName]map[className]usage
-	for _, className := range storageClassNames {
-		for _, node := range nodes {
-			var found bool
-			var capacity int64
-			for _, cap := range capacities {
-				if cap.StorageClassName == className && nodeHasAccess(node, cap) {
-					found = true
-					capacity = cap.Capacity.Value()
-				}
-			}
-			if !found {
-				continue
-			}
-			claimGroup, ok := claims[className]
-			if !ok {
-				return nil, fmt.Errorf("storage class %q is not found in claim groups", className)
-			}
-			request, err := claimGroup.totalRequiredCapacity()
-			if err != nil {
-				return nil, err
-			}
-			usage := float64(request) / float64(capacity)
-			if usage > 1 {
-				usage = 1
-			}
-			if capacityUsageMap[node.GetName()] == nil {
-				capacityUsageMap[node.GetName()] = make(map[string]int64)
-			}
-			capacityUsageMap[node.GetName()][className] = int64(usage * 100)
-		}
-	}
-
-	nodeScores := map[string]int64{}
-	for nodeName, usageMap := range capacityUsageMap {
-		nodeScores[nodeName] = 0
-		var count int64
-		for _, cap := range usageMap {
-			nodeScores[nodeName] += cap
-			count += 1
-		}
-		nodeScores[nodeName] = nodeScores[nodeName] / count
+func (pl *StorageCapacityPrioritization) hasEnoughCapacity(node *v1.Node, className string, cg claimGroup, capacities map[string]*storageClassCapacities, assumed storagecapacity.AssumedFunc) (*filterReason, error) {
+	_, reason, err := pl.findCapacity(node, className, cg, capacities, assumed)
+	if err != nil || reason == nil {
+		return nil, err
 	}
-	return nodeScores, nil
+	filteredNodes.WithLabelValues(className, reason.Type).Inc()
+	return reason, nil
 }
 
-func capacitySufficient(capacity *storagev1beta1.CSIStorageCapacity, sizeInBytes int64) bool {
-	return capacity.Capacity != nil && capacity.Capacity.Value() >= sizeInBytes
-}
-
-func nodeHasAccess(node *v1.Node, capacity *storagev1beta1.CSIStorageCapacity) bool {
-	if capacity.NodeTopology == nil {
-		// Unavailable
-		return false
-	}
-	// Only matching by label is supported.
-	selector, err := metav1.LabelSelectorAsSelector(capacity.NodeTopology)
-	if err != nil {
-		// This should never happen because NodeTopology must be valid.
-		klog.ErrorS(err, "Unexpected error converting to a label selector", "nodeTopology", capacity.NodeTopology)
-		return false
-	}
-	return selector.Matches(labels.Set(node.Labels))
+// findCapacity returns the capacity selected for the claim group on the node
+// when it's enough for the claim group, excluding the capacity assumed by
+// assumed. See storagecapacity.FindCapacity.
+func (pl *StorageCapacityPrioritization) findCapacity(node *v1.Node, className string, cg claimGroup, capacities map[string]*storageClassCapacities, assumed storagecapacity.AssumedFunc) (*capacitySelection, *filterReason, error) {
+	return storagecapacity.FindCapacity(&pl.args, node, className, cg, capacities, assumed)
 }
@@ -2,26 +2,42 @@ package storagecapacityprioritization
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	storagev1beta1 "k8s.io/api/storage/v1beta1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/component-base/metrics/testutil"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
 	schedulerconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/defaultbinder"
 	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/feature"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/queuesort"
 	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumebinding"
 	"k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	"k8s.io/utils/pointer"
 
 	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
 )
 
 var (
@@ -37,6 +53,9 @@ var (
 	waitSC = &storagev1.StorageClass{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "wait-sc",
+			Annotations: map[string]string{
+				"storageclass.kubernetes.io/is-default-class": "true",
+			},
 		},
 		VolumeBindingMode: &waitForFirstConsumer,
 		Provisioner:       waitProvisioner,
@@ -139,6 +158,26 @@ func newPluginTester(t *testing.T, ctx context.Context, nodes []*v1.Node, pvcs [
 	}, nil
 }
 
+// snapshotCapacities takes the snapshot of the capacities and lists the
+// PersistentVolumes into the states as PreFilter does, for the states which
+// are built without calling PreFilter.
+func (pl *pluginTester) snapshotCapacities(t *testing.T, states ...*framework.CycleState) {
+	for _, state := range states {
+		s, err := getStateData(state)
+		if err != nil || len(s.claimsToBind) == 0 {
+			continue
+		}
+		s.pvs, err = pl.plugin.listPersistentVolumes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.capacities, err = pl.plugin.snapshotCapacities(s.claimsToBind)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func (pl *pluginTester) PreFilter(t *testing.T, ctx context.Context, pod *v1.Pod, state *framework.CycleState, expect *framework.Status) {
 	t.Logf("Verify: call PreFilter and check status")
 	result := pl.plugin.PreFilter(context.Background(), state, pod)
@@ -204,6 +243,7 @@ func TestStorageCapacityPrioritizationPreFilter(t *testing.T) {
 	}{
 		{
 			name: "PreFilter",
+			pod:  makePod("pod-a").Pod,
 			state: (func() *framework.CycleState {
 				return framework.NewCycleState()
 			})(),
@@ -214,6 +254,118 @@ func TestStorageCapacityPrioritizationPreFilter(t *testing.T) {
 				return state
 			})(),
 		},
+		{
+			name: "pod has unbound waitForConsumer pvcs",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").withPVCVolume("pvc-b", "").withPVCVolume("pvc-c", "").Pod,
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
+				makePVC("pvc-b", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).withBoundPV("pv-b").PersistentVolumeClaim,
+				makePVC("pvc-c", immediateSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
+			},
+			state: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+			expect: nil,
+			expectState: (func() *framework.CycleState {
+				claim := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim
+				capacities := map[string]*storageClassCapacities{
+					waitSC.Name: {Tracked: true, Capacities: []*csiStorageCapacity{}, Policy: storagecapacity.Policy{}},
+				}
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{claim},
+					capacities:        capacities,
+					storageClassNames: sets.NewString(),
+					index: &capacityIndex{
+						claims:     claimsByStorageClass{waitSC.Name: claimGroup{claim}},
+						promising:  map[string][]*csiStorageCapacity{waitSC.Name: nil},
+						capacities: capacities,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pvc is not found",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			state: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+			expect: framework.NewStatus(framework.UnschedulableAndUnresolvable, `error getting PVC "default/pvc-a": persistentvolumeclaim "pvc-a" not found`),
+			expectState: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+		},
+		{
+			name: "ephemeral volume claim is not created yet",
+			pod:  makePod("pod-a").withEphemeralVolume("vol-a", makePVC("", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).Spec).Pod,
+			state: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+			expect: nil,
+			expectState: (func() *framework.CycleState {
+				claim := makePVC("pod-a-vol-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim
+				capacities := map[string]*storageClassCapacities{
+					waitSC.Name: {Tracked: true, Capacities: []*csiStorageCapacity{}, Policy: storagecapacity.Policy{}},
+				}
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{claim},
+					capacities:        capacities,
+					storageClassNames: sets.NewString(),
+					index: &capacityIndex{
+						claims:     claimsByStorageClass{waitSC.Name: claimGroup{claim}},
+						promising:  map[string][]*csiStorageCapacity{waitSC.Name: nil},
+						capacities: capacities,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "ephemeral volume claim template has no storage class",
+			pod: makePod("pod-a").withEphemeralVolume("vol-a", v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("50Gi")},
+				},
+			}).Pod,
+			state: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+			expect: nil,
+			expectState: (func() *framework.CycleState {
+				claim := makePVC("pod-a-vol-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim
+				capacities := map[string]*storageClassCapacities{
+					waitSC.Name: {Tracked: true, Capacities: []*csiStorageCapacity{}, Policy: storagecapacity.Policy{}},
+				}
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{claim},
+					capacities:        capacities,
+					storageClassNames: sets.NewString(),
+					index: &capacityIndex{
+						claims:     claimsByStorageClass{waitSC.Name: claimGroup{claim}},
+						promising:  map[string][]*csiStorageCapacity{waitSC.Name: nil},
+						capacities: capacities,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "ephemeral volume claim is not created for the pod",
+			pod:  makePod("pod-a").withEphemeralVolume("vol-a", makePVC("", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).Spec).Pod,
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pod-a-vol-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
+			},
+			state: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+			expect: framework.NewStatus(framework.UnschedulableAndUnresolvable, `PVC "default/pod-a-vol-a" was not created for the pod`),
+			expectState: (func() *framework.CycleState {
+				return framework.NewCycleState()
+			})(),
+		},
 	}
 	for _, item := range table {
 		t.Run(item.name, func(t *testing.T) {
@@ -232,6 +384,10 @@ func TestStorageCapacityPrioritizationPreFilter(t *testing.T) {
 }
 
 func TestStorageCapacityPrioritizationFilter(t *testing.T) {
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
 	table := []struct {
 		name        string
 		pod         *v1.Pod
@@ -255,13 +411,11 @@ func TestStorageCapacityPrioritizationFilter(t *testing.T) {
 			})(),
 			state: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				state.Write(framework.StateKey(volumebinding.Name), &volumebinding.StateData{})
 				state.Write(stateKey, &stateData{storageClassNames: sets.NewString()})
 				return state
 			})(),
 			expectState: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				state.Write(framework.StateKey(volumebinding.Name), &volumebinding.StateData{})
 				state.Write(stateKey, &stateData{storageClassNames: sets.NewString()})
 				return state
 			})(),
@@ -296,36 +450,16 @@ func TestStorageCapacityPrioritizationFilter(t *testing.T) {
 			})(),
 			state: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				podVolumes := map[string]*volumebinding.PodVolumes{
-					"zone-a-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-b-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-c-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(nil, podVolumes))
-				state.Write(stateKey, &stateData{storageClassNames: sets.NewString()})
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+				})
 				return state
 			})(),
 			expectState: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				podVolumes := map[string]*volumebinding.PodVolumes{
-					"zone-a-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-b-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-c-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(nil, podVolumes))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
 					storageClassNames: sets.NewString(waitSC.Name),
 				})
 				return state
@@ -371,36 +505,162 @@ func TestStorageCapacityPrioritizationFilter(t *testing.T) {
 			})(),
 			state: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				podVolumes := map[string]*volumebinding.PodVolumes{
-					"zone-a-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-b-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-c-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(waitSC.Name),
+					rejections: map[string]*storageClassRejections{
+						waitSC.Name: {requested: gi("50Gi"), largestAvailable: gi("49Gi"), capacityRejected: 2},
 					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs - (matching pv is available)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
+			},
+			pvs: []*v1.PersistentVolume{
+				makePV("pv-a", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withPhase(v1.VolumeAvailable).withNodeAffinity(map[string][]string{
+					"topology.kubernetes.io/zone": {"zone-b"},
+				}).PersistentVolume,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("49Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+				makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("49Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-b",
+				})).CSIStorageCapacity,
+			},
+			expects: (func() []*framework.Status {
+				return []*framework.Status{
+					(func() *framework.Status {
+						q := resource.MustParse("50Gi")
+						return framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", "zone-a-node-a", (&q).Value()))
+					})(),
+					nil,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(nil, podVolumes))
-				state.Write(stateKey, &stateData{storageClassNames: sets.NewString()})
+			})(),
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+				})
 				return state
 			})(),
 			expectState: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				podVolumes := map[string]*volumebinding.PodVolumes{
-					"zone-a-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-b-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
-					},
-					"zone-c-node-a": {
-						DynamicProvisions: []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+					rejections: map[string]*storageClassRejections{
+						waitSC.Name: {requested: gi("50Gi"), largestAvailable: gi("49Gi"), capacityRejected: 1},
 					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs - (exceed maximum volume size)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withMaximumVolumeSize(resource.MustParse("20Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+				makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withMaximumVolumeSize(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-b",
+				})).CSIStorageCapacity,
+			},
+			expects: (func() []*framework.Status {
+				return []*framework.Status{
+					(func() *framework.Status {
+						q := resource.MustParse("30Gi")
+						return framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("claim default/pvc-a exceeds the maximum volume size of csi storage capacity objects. node=%q sizeInBytes=%d", "zone-a-node-a", (&q).Value()))
+					})(),
+					nil,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(nil, podVolumes))
+			})(),
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(waitSC.Name),
+					rejections: map[string]*storageClassRejections{
+						waitSC.Name: {requested: gi("30Gi"), largestAvailable: gi("100Gi"), capacityRejected: 1},
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs - (node is not covered by csi storage capacity objects)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+			},
+			args: &config.StorageCapacityPrioritizationArgs{
+				UnknownCapacity: config.NeutralUnknownCapacity,
+			},
+			expects: (func() []*framework.Status {
+				return []*framework.Status{nil, nil}
+			})(),
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
+					storageClassNames: sets.NewString(),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
 				state.Write(stateKey, &stateData{
+					claimsToBind:      []*v1.PersistentVolumeClaim{makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim},
 					storageClassNames: sets.NewString(waitSC.Name),
 				})
 				return state
@@ -415,6 +675,7 @@ func TestStorageCapacityPrioritizationFilter(t *testing.T) {
 			if err != nil {
 				return
 			}
+			tester.snapshotCapacities(t, item.state, item.expectState)
 			tester.Filter(t, ctx, item.pod, item.state, item.expects)
 			if !reflect.DeepEqual(item.state, item.expectState) {
 				t.Errorf("filter cycle state does not match: %v, want: %v", item.state, item.expectState)
@@ -467,8 +728,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 				claimsToBind := []*v1.PersistentVolumeClaim{
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name),
 				})
 				return state
@@ -478,8 +739,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 				claimsToBind := []*v1.PersistentVolumeClaim{
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("50Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name),
 					scores: map[string]int64{
 						"zone-a-node-a": 100,
@@ -521,8 +782,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 				claimsToBind := []*v1.PersistentVolumeClaim{
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name),
 				})
 				return state
@@ -532,8 +793,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 				claimsToBind := []*v1.PersistentVolumeClaim{
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name),
 					scores: map[string]int64{
 						"zone-a-node-a": 50,
@@ -586,8 +847,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
 					makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name, waitHDDSC.Name),
 				})
 				return state
@@ -598,8 +859,8 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
 					makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim,
 				}
-				state.Write(framework.StateKey(volumebinding.Name), volumebinding.FakeStateData(claimsToBind, nil))
 				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
 					storageClassNames: sets.NewString(waitSC.Name, waitHDDSC.Name),
 					scores: map[string]int64{
 						"zone-a-node-a": 30,
@@ -610,44 +871,262 @@ func TestStorageCapacityPrioritizationPreScore(t *testing.T) {
 				return state
 			})(),
 		},
-	}
-	for _, item := range table {
-		t.Run(item.name, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			tester, err := newPluginTester(t, ctx, item.nodes, item.pvcs, item.pvs, item.cscs, item.args)
-			if err != nil {
-				return
-			}
-			tester.filteredNodeInfos = tester.nodeInfos
-			tester.PreScore(t, ctx, item.pod, item.state, item.expect)
-			if !reflect.DeepEqual(item.state, item.expectState) {
-				t.Errorf("prescore cycle state does not match: %v, want: %v", item.state, item.expectState)
-			}
-		})
-	}
-}
-
-func TestStorageCapacityPrioritizationScore(t *testing.T) {
-	table := []struct {
-		name         string
-		nodes        []*v1.Node
-		state        *framework.CycleState
-		expects      []*framework.Status
-		expectScores []int64
-	}{
 		{
-			name: "Score",
+			name: "pod has unbound waitForConsumer pvcs(weighted multi storage class)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").withPVCVolume("pvc-b", "").Pod,
 			nodes: []*v1.Node{
-				makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
-				makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
-				makeNode("zone-c-node-a").withLabel("topology.kubernetes.io/zone", "zone-c").Node,
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+				makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+				makeCSC("2", waitHDDSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
 			},
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{
+						StorageClassName: waitSC.Name,
+						Weight:           pointer.Int32Ptr(3),
+					},
+				},
+			},
+			expect: nil,
 			state: (func() *framework.CycleState {
 				state := framework.NewCycleState()
-				state.Write(stateKey, &stateData{
-					scores: map[string]int64{
-						"zone-a-node-a": 10,
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+					makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name, waitHDDSC.Name),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+					makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name, waitHDDSC.Name),
+					scores: map[string]int64{
+						"zone-a-node-a": 35,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs(LeastAllocated)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+				makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-b",
+				})).CSIStorageCapacity,
+			},
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.LeastAllocated,
+				},
+			},
+			expect: nil,
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+					scores: map[string]int64{
+						"zone-a-node-a": 60,
+						"zone-b-node-a": 80,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs(RequestedToCapacityRatio)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("40Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+				makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-b",
+				})).CSIStorageCapacity,
+			},
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.RequestedToCapacityRatio,
+					RequestedToCapacityRatio: &config.RequestedToCapacityRatioParam{
+						Shape: []config.UtilizationShapePoint{
+							{Utilization: 0, Score: 0},
+							{Utilization: 50, Score: 10},
+							{Utilization: 100, Score: 0},
+						},
+					},
+				},
+			},
+			expect: nil,
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("20Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+					scores: map[string]int64{
+						"zone-a-node-a": 100,
+						"zone-b-node-a": 40,
+					},
+				})
+				return state
+			})(),
+		},
+		{
+			name: "pod has unbound waitForConsumer pvcs(node is not covered by csi storage capacity objects)",
+			pod:  makePod("pod-a").withPVCVolume("pvc-a", "").Pod,
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").
+					withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+			},
+			pvcs: []*v1.PersistentVolumeClaim{
+				makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim,
+			},
+			cscs: []*storagev1beta1.CSIStorageCapacity{
+				makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withTopology(labels.Set(map[string]string{
+					"topology.kubernetes.io/zone": "zone-a",
+				})).CSIStorageCapacity,
+			},
+			args: &config.StorageCapacityPrioritizationArgs{
+				UnknownCapacity: config.MaxUnknownCapacity,
+			},
+			expect: nil,
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+				})
+				return state
+			})(),
+			expectState: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				claimsToBind := []*v1.PersistentVolumeClaim{
+					makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim,
+				}
+				state.Write(stateKey, &stateData{
+					claimsToBind:      claimsToBind,
+					storageClassNames: sets.NewString(waitSC.Name),
+					scores: map[string]int64{
+						"zone-a-node-a": 25,
+						"zone-b-node-a": 100,
+					},
+				})
+				return state
+			})(),
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tester, err := newPluginTester(t, ctx, item.nodes, item.pvcs, item.pvs, item.cscs, item.args)
+			if err != nil {
+				return
+			}
+			tester.filteredNodeInfos = tester.nodeInfos
+			tester.snapshotCapacities(t, item.state, item.expectState)
+			tester.PreScore(t, ctx, item.pod, item.state, item.expect)
+			if !reflect.DeepEqual(item.state, item.expectState) {
+				t.Errorf("prescore cycle state does not match: %v, want: %v", item.state, item.expectState)
+			}
+		})
+	}
+}
+
+func TestStorageCapacityPrioritizationScore(t *testing.T) {
+	table := []struct {
+		name         string
+		nodes        []*v1.Node
+		state        *framework.CycleState
+		expects      []*framework.Status
+		expectScores []int64
+	}{
+		{
+			name: "Score",
+			nodes: []*v1.Node{
+				makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+				makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+				makeNode("zone-c-node-a").withLabel("topology.kubernetes.io/zone", "zone-c").Node,
+			},
+			state: (func() *framework.CycleState {
+				state := framework.NewCycleState()
+				state.Write(stateKey, &stateData{
+					scores: map[string]int64{
+						"zone-a-node-a": 10,
 						"zone-b-node-a": 20,
 						"zone-c-node-a": 30,
 					},
@@ -672,6 +1151,82 @@ func TestStorageCapacityPrioritizationScore(t *testing.T) {
 	}
 }
 
+func TestStorageCapacityPrioritizationNormalizeScore(t *testing.T) {
+	rawScores := map[string]float64{
+		"node-a": 0.2,
+		"node-b": 0.5,
+		"node-c": 0.5,
+		"node-d": 1.0,
+	}
+	table := []struct {
+		name          string
+		normalization config.ScoreNormalizationType
+		rawScores     map[string]float64
+		expectScores  []int64
+	}{
+		{
+			name:          "min-max",
+			normalization: config.MinMaxScoreNormalization,
+			rawScores:     rawScores,
+			expectScores:  []int64{0, 37, 37, 100, 0},
+		},
+		{
+			name:          "rank",
+			normalization: config.RankScoreNormalization,
+			rawScores:     rawScores,
+			expectScores:  []int64{0, 50, 50, 100, 0},
+		},
+		{
+			name:          "same raw scores",
+			normalization: config.MinMaxScoreNormalization,
+			rawScores: map[string]float64{
+				"node-a": 0.5,
+				"node-b": 0.5,
+			},
+			expectScores: []int64{0, 0, 0, 0, 0},
+		},
+		{
+			name:          "no raw scores",
+			normalization: config.RankScoreNormalization,
+			expectScores:  []int64{0, 0, 0, 0, 0},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			pl := &StorageCapacityPrioritization{
+				args: config.StorageCapacityPrioritizationArgs{ScoreNormalization: item.normalization},
+			}
+			if pl.ScoreExtensions() == nil {
+				t.Fatalf("score extensions must be returned for normalization %q", item.normalization)
+			}
+			state := framework.NewCycleState()
+			state.Write(stateKey, &stateData{rawScores: item.rawScores})
+			scores := framework.NodeScoreList{
+				{Name: "node-a"},
+				{Name: "node-b"},
+				{Name: "node-c"},
+				{Name: "node-d"},
+				{Name: "node-e"},
+			}
+			if status := pl.NormalizeScore(context.Background(), state, makePod("pod-a").Pod, scores); !status.IsSuccess() {
+				t.Fatalf("normalize score failed: %v", status)
+			}
+			got := make([]int64, 0, len(scores))
+			for _, score := range scores {
+				got = append(got, score.Score)
+			}
+			if !reflect.DeepEqual(got, item.expectScores) {
+				t.Errorf("normalized scores do not match: %v, want: %v", got, item.expectScores)
+			}
+		})
+	}
+
+	pl := &StorageCapacityPrioritization{}
+	if pl.ScoreExtensions() != nil {
+		t.Errorf("score extensions must not be returned without normalization")
+	}
+}
+
 func TestStorageCapacityPrioritization(t *testing.T) {
 	table := []struct {
 		name                        string
@@ -790,3 +1345,1098 @@ func TestStorageCapacityPrioritization(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateStorageCapacityPrioritizationArgs(t *testing.T) {
+	table := []struct {
+		name    string
+		args    *config.StorageCapacityPrioritizationArgs
+		wantErr bool
+	}{
+		{
+			name: "empty args",
+			args: &config.StorageCapacityPrioritizationArgs{},
+		},
+		{
+			name: "LeastAllocated",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{Type: config.LeastAllocated},
+			},
+		},
+		{
+			name: "unknown strategy",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{Type: "Unknown"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "RequestedToCapacityRatio without shape",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{Type: config.RequestedToCapacityRatio},
+			},
+			wantErr: true,
+		},
+		{
+			name: "RequestedToCapacityRatio with unsorted shape",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.RequestedToCapacityRatio,
+					RequestedToCapacityRatio: &config.RequestedToCapacityRatioParam{
+						Shape: []config.UtilizationShapePoint{
+							{Utilization: 50, Score: 10},
+							{Utilization: 0, Score: 0},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "RequestedToCapacityRatio with out of range score",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.RequestedToCapacityRatio,
+					RequestedToCapacityRatio: &config.RequestedToCapacityRatioParam{
+						Shape: []config.UtilizationShapePoint{
+							{Utilization: 0, Score: 0},
+							{Utilization: 100, Score: 11},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "storage class policies",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", Weight: pointer.Int32Ptr(10), ScoringStrategy: &config.ScoringStrategy{Type: config.LeastAllocated}},
+					{Provisioner: "topolvm.cybozu.com", Weight: pointer.Int32Ptr(1)},
+				},
+			},
+		},
+		{
+			name: "storage class policy without target",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{Weight: pointer.Int32Ptr(10)},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "storage class policy with duplicated name",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", Weight: pointer.Int32Ptr(10)},
+					{StorageClassName: "fast", Weight: pointer.Int32Ptr(1)},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "storage class policy with zero weight",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", Weight: pointer.Int32Ptr(0)},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "storage class policy with out of range weight",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", Weight: pointer.Int32Ptr(101)},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown capacity aggregation",
+			args: &config.StorageCapacityPrioritizationArgs{
+				CapacityAggregation: "Min",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown score normalization",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoreNormalization: "ZScore",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative score explanation nodes",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoreExplanationNodes: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved capacity percentage is out of range",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", ReservedCapacityPercentage: 101},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "overcommit percentage is less than 100",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", OvercommitPercentage: 50},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "max used capacity percentage is over 100",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{
+					{StorageClassName: "fast", OvercommitPercentage: 200, MaxUsedCapacityPercentage: 101},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown unknown capacity policy",
+			args: &config.StorageCapacityPrioritizationArgs{
+				UnknownCapacity: "Ignore",
+			},
+			wantErr: true,
+		},
+		{
+			name: "MostAllocated with shape",
+			args: &config.StorageCapacityPrioritizationArgs{
+				ScoringStrategy: &config.ScoringStrategy{
+					Type: config.MostAllocated,
+					RequestedToCapacityRatio: &config.RequestedToCapacityRatioParam{
+						Shape: []config.UtilizationShapePoint{
+							{Utilization: 0, Score: 0},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			err := validateStorageCapacityPrioritizationArgs(nil, item.args)
+			if (err != nil) != item.wantErr {
+				t.Errorf("validation error does not match got: %v, wantErr: %v", err, item.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorageCapacityPrioritizationReserve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvcA := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	pvcB := makePVC("pvc-b", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvcA, pvcB}, nil, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podA := makePod("pod-a").withPVCVolume(pvcA.Name, "").Pod
+	podA.UID = "pod-a"
+	stateA := framework.NewCycleState()
+	stateA.Write(stateKey, &stateData{claimsToBind: []*v1.PersistentVolumeClaim{pvcA}, storageClassNames: sets.NewString()})
+	tester.snapshotCapacities(t, stateA)
+	if status := tester.plugin.Reserve(ctx, stateA, podA, "zone-a-node-a"); status != nil {
+		t.Fatalf("reserve status does not match got: %+v, want: nil", status)
+	}
+
+	podB := makePod("pod-b").withPVCVolume(pvcB.Name, "").Pod
+	podB.UID = "pod-b"
+	newStateB := func() *framework.CycleState {
+		state := framework.NewCycleState()
+		state.Write(stateKey, &stateData{claimsToBind: []*v1.PersistentVolumeClaim{pvcB}, storageClassNames: sets.NewString()})
+		tester.snapshotCapacities(t, state)
+		return state
+	}
+
+	t.Log("Verify: the capacity assumed by pod-a is not available for pod-b")
+	q := resource.MustParse("30Gi")
+	tester.Filter(t, ctx, podB, newStateB(), []*framework.Status{
+		framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", "zone-a-node-a", (&q).Value())),
+		nil,
+	})
+
+	t.Log("Verify: the capacity is available again after unreserving pod-a")
+	tester.plugin.Unreserve(ctx, stateA, podA, "zone-a-node-a")
+	tester.Filter(t, ctx, podB, newStateB(), []*framework.Status{nil, nil})
+}
+
+func TestStorageCapacityPrioritizationReservePersistentVolume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvcA := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	pvcB := makePVC("pvc-b", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	pv := makePV("pv-a", waitSC.Name).withCapacity(resource.MustParse("30Gi")).withPhase(v1.VolumeAvailable).withNodeAffinity(map[string][]string{
+		"topology.kubernetes.io/zone": {"zone-b"},
+	}).PersistentVolume
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("20Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("20Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvcA, pvcB}, []*v1.PersistentVolume{pv}, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podA := makePod("pod-a").withPVCVolume(pvcA.Name, "").Pod
+	podA.UID = "pod-a"
+	stateA := framework.NewCycleState()
+	stateA.Write(stateKey, &stateData{claimsToBind: []*v1.PersistentVolumeClaim{pvcA}, storageClassNames: sets.NewString()})
+	tester.snapshotCapacities(t, stateA)
+	if status := tester.plugin.Reserve(ctx, stateA, podA, "zone-b-node-a"); status != nil {
+		t.Fatalf("reserve status does not match got: %+v, want: nil", status)
+	}
+
+	podB := makePod("pod-b").withPVCVolume(pvcB.Name, "").Pod
+	podB.UID = "pod-b"
+	newStateB := func() *framework.CycleState {
+		state := framework.NewCycleState()
+		state.Write(stateKey, &stateData{claimsToBind: []*v1.PersistentVolumeClaim{pvcB}, storageClassNames: sets.NewString()})
+		tester.snapshotCapacities(t, state)
+		return state
+	}
+	q := resource.MustParse("30Gi")
+	rejected := func(nodeName string) *framework.Status {
+		return framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", nodeName, (&q).Value()))
+	}
+
+	t.Log("Verify: the persistent volume assumed by pod-a is not matched to the claim of pod-b")
+	tester.Filter(t, ctx, podB, newStateB(), []*framework.Status{rejected("zone-a-node-a"), rejected("zone-b-node-a")})
+
+	t.Log("Verify: the persistent volume is matched again after unreserving pod-a")
+	tester.plugin.Unreserve(ctx, stateA, podA, "zone-b-node-a")
+	tester.Filter(t, ctx, podB, newStateB(), []*framework.Status{rejected("zone-a-node-a"), nil})
+}
+
+func TestAssumedVolumeCacheAvailable(t *testing.T) {
+	pvA := makePV("pv-a", waitSC.Name).PersistentVolume
+	pvB := makePV("pv-b", waitSC.Name).PersistentVolume
+	claimed := pvA.DeepCopy()
+	claimed.Spec.ClaimRef = &v1.ObjectReference{Namespace: "default", Name: "pvc-a"}
+
+	cache := newAssumedVolumeCache()
+	cache.assume("pod-a", []*v1.PersistentVolume{pvA})
+	if got := cache.available([]*v1.PersistentVolume{pvA, pvB}); !reflect.DeepEqual(got, []*v1.PersistentVolume{pvB}) {
+		t.Errorf("available persistent volumes do not match: %v, want: %v", got, []*v1.PersistentVolume{pvB})
+	}
+	// The claimed persistent volume is skipped by FindMatchingVolume anyway,
+	// so the assumption is expired.
+	cache.available([]*v1.PersistentVolume{claimed, pvB})
+	if len(cache.assumed) != 0 {
+		t.Errorf("assumed persistent volumes are not expired: %v", cache.assumed)
+	}
+}
+
+func TestAssumedCapacityCacheAssumedBytes(t *testing.T) {
+	pending := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	bound := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).withBoundPV("pv-a").PersistentVolumeClaim
+	capacity := func(size, resourceVersion string) *csiStorageCapacity {
+		c := makeCSC("1", waitSC.Name).withCapacity(resource.MustParse(size)).toCapacity()
+		c.ResourceVersion = resourceVersion
+		return c
+	}
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+
+	table := []struct {
+		name     string
+		claim    *v1.PersistentVolumeClaim
+		capacity *csiStorageCapacity
+		expect   int64
+	}{
+		{
+			name:     "capacity is not updated",
+			claim:    pending,
+			capacity: capacity("50Gi", "1"),
+			expect:   gi("30Gi"),
+		},
+		{
+			name:     "update without the volume keeps the assumption",
+			claim:    pending,
+			capacity: capacity("50Gi", "2"),
+			expect:   gi("30Gi"),
+		},
+		{
+			name:     "capacity going up keeps the assumption",
+			claim:    pending,
+			capacity: capacity("60Gi", "2"),
+			expect:   gi("30Gi"),
+		},
+		{
+			name:     "capacity going down expires the assumption",
+			claim:    pending,
+			capacity: capacity("20Gi", "2"),
+			expect:   0,
+		},
+		{
+			name:     "bound claim expires the assumption",
+			claim:    bound,
+			capacity: capacity("50Gi", "1"),
+			expect:   0,
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(item.claim); err != nil {
+				t.Fatal(err)
+			}
+			c := newAssumedCapacityCache(corelisters.NewPersistentVolumeClaimLister(indexer))
+			if err := c.assume("pod-a", capacity("50Gi", "1"), []*v1.PersistentVolumeClaim{item.claim}, gi("30Gi")); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.assumedBytes(item.capacity); got != item.expect {
+				t.Errorf("assumed bytes do not match got: %d, want: %d", got, item.expect)
+			}
+			if expired := item.expect == 0; expired != (len(c.assumed) == 0) {
+				t.Errorf("assumption is not expired as expected: %+v", c.assumed)
+			}
+		})
+	}
+}
+
+func TestNewCSIStorageCapacityFromUnstructured(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "storage.k8s.io/v1",
+		"kind":       "CSIStorageCapacity",
+		"metadata": map[string]interface{}{
+			"name":            "csisc-1",
+			"namespace":       "default",
+			"resourceVersion": "10",
+		},
+		"storageClassName": waitSC.Name,
+		"nodeTopology": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"topology.kubernetes.io/zone": "zone-a",
+			},
+		},
+		"capacity":          "50Gi",
+		"maximumVolumeSize": "10Gi",
+	}}
+	got, err := storagecapacity.NewFromUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withMaximumVolumeSize(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+		"topology.kubernetes.io/zone": "zone-a",
+	})).toCapacity()
+	expect.ResourceVersion = "10"
+	if got.Name != expect.Name || got.Namespace != expect.Namespace || got.ResourceVersion != expect.ResourceVersion ||
+		got.StorageClassName != expect.StorageClassName ||
+		!reflect.DeepEqual(got.NodeTopology, expect.NodeTopology) ||
+		got.Capacity.Cmp(*expect.Capacity) != 0 || got.MaximumVolumeSize.Cmp(*expect.MaximumVolumeSize) != 0 {
+		t.Errorf("csi storage capacity does not match got: %+v, want: %+v", got, expect)
+	}
+}
+
+func TestCSIStorageCapacityListerListByStorageClass(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+		makeCSC("3", waitHDDSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nil, nil, nil, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for className, expect := range map[string][]string{
+		waitSC.Name:      {"csisc-1", "csisc-2"},
+		waitHDDSC.Name:   {"csisc-3"},
+		immediateSC.Name: {},
+	} {
+		capacities, err := tester.plugin.csiStorageCapacityLister.ListByStorageClass(className)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, capacity := range capacities {
+			if capacity.Selector() == nil {
+				t.Errorf("node topology of %q is not compiled", capacity.Name)
+			}
+			got = append(got, capacity.Name)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("capacities of storage class %q do not match got: %v, want: %v", className, got, expect)
+		}
+	}
+}
+
+func TestStorageCapacityPrioritizationPostFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	pvc.UID = "pvc-a-uid"
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+		makeNode("zone-c-node-a").withLabel("topology.kubernetes.io/zone", "zone-c").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("20Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvc}, nil, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := events.NewFakeRecorder(10)
+	tester.plugin.eventRecorder = recorder
+
+	pod := makePod("pod-a").withPVCVolume(pvc.Name, "").Pod
+	state := framework.NewCycleState()
+	tester.PreFilter(t, ctx, pod, state, nil)
+	for _, nodeInfo := range tester.nodeInfos {
+		if status := tester.plugin.Filter(ctx, state, pod, nodeInfo); status.IsSuccess() {
+			t.Fatalf("filter status does not match got: %v, want: %v", status, framework.UnschedulableAndUnresolvable)
+		}
+	}
+	if _, status := tester.plugin.PostFilter(ctx, state, pod, framework.NodeToStatusMap{}); status.Code() != framework.Unschedulable {
+		t.Errorf("post filter status does not match got: %v, want: %v", status, framework.Unschedulable)
+	}
+
+	expect := fmt.Sprintf("Warning InsufficientStorageCapacity storage class %q: requested 30Gi, largest available 20Gi, 2 node(s) rejected for insufficient capacity, 1 node(s) not covered by csi storage capacity objects", waitSC.Name)
+	for _, regarding := range []string{"pod", "pvc"} {
+		select {
+		case got := <-recorder.Events:
+			if got != expect {
+				t.Errorf("%s event does not match got: %q, want: %q", regarding, got, expect)
+			}
+		default:
+			t.Errorf("%s event is not emitted", regarding)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	pod := makePod("pod-a").withPVCVolume(pvc.Name, "").Pod
+	objects := []apiruntime.Object{
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		waitSC,
+		waitCSIDriver,
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+		pvc,
+		pod,
+	}
+
+	results, err := Simulate(context.Background(), &config.StorageCapacityPrioritizationArgs{}, objects, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("number of results does not match got: %d, want: %d", len(results), 2)
+	}
+	if got := results[0]; got.Node != "zone-a-node-a" || got.Feasible || len(got.Reasons) != 1 || got.Score != nil {
+		t.Errorf("result of zone-a does not match got: %+v, want: rejected with a reason", got)
+	}
+	if got := results[1]; got.Node != "zone-b-node-a" || !got.Feasible || got.Score == nil {
+		t.Errorf("result of zone-b does not match got: %+v, want: feasible with a score", got)
+	}
+}
+
+func TestReportCapacities(t *testing.T) {
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("5Gi")).withPhase(v1.ClaimPending).PersistentVolumeClaim
+	metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, pvutil.AnnSelectedNode, "zone-b-node-a")
+	objects := []apiruntime.Object{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+		waitSC,
+		waitCSIDriver,
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withMaximumVolumeSize(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+		pvc,
+	}
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+
+	got, err := ReportCapacities(context.Background(), &config.StorageCapacityPrioritizationArgs{}, objects, gi("20Gi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*CapacityReport{
+		{
+			Node:                 "zone-a-node-a",
+			StorageClass:         waitSC.Name,
+			CSIStorageCapacities: []string{v1.NamespaceDefault + "/csisc-1"},
+			Capacity:             gi("10Gi"),
+			Available:            gi("10Gi"),
+		},
+		{
+			Node:                 "zone-b-node-a",
+			StorageClass:         waitSC.Name,
+			CSIStorageCapacities: []string{v1.NamespaceDefault + "/csisc-2"},
+			Capacity:             gi("100Gi"),
+			Available:            gi("100Gi"),
+			MaximumVolumeSize:    gi("50Gi"),
+			PendingDemand:        gi("5Gi"),
+			Feasible:             true,
+			Usage:                0.2,
+			Score:                20,
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		for i := range got {
+			t.Logf("got[%d]: %+v", i, got[i])
+		}
+		t.Errorf("capacity reports do not match")
+	}
+}
+
+func TestStorageCapacityPrioritizationCapacityIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	hddPVC := makePVC("pvc-b", waitHDDSC.Name).withRequestStorage(resource.MustParse("10Gi")).PersistentVolumeClaim
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+		makeNode("zone-c-node-a").withLabel("topology.kubernetes.io/zone", "zone-c").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+		makeCSC("3", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-c",
+		})).CSIStorageCapacity,
+	}
+	// The claims of waitHDDSC may be bound to the available volume, so the
+	// nodes are narrowed down by waitSC only.
+	pv := makePV("pv-a", waitHDDSC.Name).withCapacity(resource.MustParse("10Gi")).withNodeAffinity(map[string][]string{
+		"topology.kubernetes.io/zone": {"zone-b"},
+	}).withPhase(v1.VolumeAvailable).PersistentVolume
+
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvc, hddPVC}, []*v1.PersistentVolume{pv}, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod := makePod("pod-a").withPVCSVolume([]*v1.PersistentVolumeClaim{pvc, hddPVC}).Pod
+	state := framework.NewCycleState()
+	tester.PreFilter(t, ctx, pod, state, nil)
+	s, err := getStateData(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []sets.String{sets.NewString(waitSC.Name), sets.NewString(), sets.NewString()} {
+		got := sets.NewString()
+		for className := range s.index.hopelessClaims(nodes[i]) {
+			got.Insert(className)
+		}
+		if !got.Equal(expect) {
+			t.Errorf("hopeless storage classes do not match for node %q got: %v, want: %v", nodes[i].Name, got.List(), expect.List())
+		}
+	}
+
+	q := resource.MustParse("30Gi")
+	hddQ := resource.MustParse("10Gi")
+	tester.Filter(t, ctx, pod, state, []*framework.Status{
+		framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", nodes[0].Name, (&q).Value())),
+		nil,
+		framework.NewStatus(framework.UnschedulableAndUnresolvable, fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", nodes[2].Name, (&hddQ).Value())),
+	})
+	if got := s.rejections[waitSC.Name]; got == nil || got.capacityRejected != 1 {
+		t.Errorf("rejections do not match got: %+v, want: 1 node rejected for insufficient capacity", got)
+	}
+}
+
+// fakePodNominator is a PodNominator without nominated pods.
+type fakePodNominator struct{}
+
+func (fakePodNominator) AddNominatedPod(pod *framework.PodInfo, nominatingInfo *framework.NominatingInfo) {
+}
+func (fakePodNominator) DeleteNominatedPodIfExists(pod *v1.Pod)                           {}
+func (fakePodNominator) UpdateNominatedPod(oldPod *v1.Pod, newPodInfo *framework.PodInfo) {}
+func (fakePodNominator) NominatedPodsForNode(nodeName string) []*framework.PodInfo {
+	return nil
+}
+
+// registerPlugin sets the handle of the plugin to a framework which runs the
+// plugin at PreFilter and Filter, so that the preemption runs the plugin.
+func (pl *pluginTester) registerPlugin(t *testing.T) {
+	fh, err := runtime.NewFramework(runtime.Registry{
+		queuesort.Name:     queuesort.New,
+		defaultbinder.Name: defaultbinder.New,
+		Name: func(_ apiruntime.Object, _ framework.Handle) (framework.Plugin, error) {
+			return pl.plugin, nil
+		},
+	}, &schedulerconfig.KubeSchedulerProfile{
+		SchedulerName: "test-scheduler",
+		Plugins: &schedulerconfig.Plugins{
+			QueueSort: schedulerconfig.PluginSet{Enabled: []schedulerconfig.Plugin{{Name: queuesort.Name}}},
+			PreFilter: schedulerconfig.PluginSet{Enabled: []schedulerconfig.Plugin{{Name: Name}}},
+			Filter:    schedulerconfig.PluginSet{Enabled: []schedulerconfig.Plugin{{Name: Name}}},
+			Bind:      schedulerconfig.PluginSet{Enabled: []schedulerconfig.Plugin{{Name: defaultbinder.Name}}},
+		},
+	}, runtime.WithPodNominator(fakePodNominator{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl.plugin.handle = fh
+}
+
+func TestStorageCapacityPrioritizationPostFilterPreemption(t *testing.T) {
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	zoneNodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+	}
+	zoneCSCs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+	}
+	poolNodes := []*v1.Node{
+		makeNode("pool-node-a").withLabel("pool-x", "true").withLabel("pool-y", "true").Node,
+	}
+	poolCSCs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"pool-x": "true",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("5Gi")).withTopology(labels.Set(map[string]string{
+			"pool-y": "true",
+		})).CSIStorageCapacity,
+	}
+	// victim returns a pod with a generic ephemeral volume bound to a local
+	// volume of the size, and the claim and the volume of it.
+	victim := func(name, nodeName, size string, topology map[string][]string) (*v1.Pod, *v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+		pod := makePod(name).withNodeName(nodeName).withPriority(0).withEphemeralVolume("data", v1.PersistentVolumeClaimSpec{
+			StorageClassName: &waitSC.Name,
+		}).Pod
+		pod.UID = types.UID(name + "-uid")
+		pod.Labels = map[string]string{"app": name}
+		pv := makePV("pv-"+name, waitSC.Name).withCapacity(resource.MustParse(size)).withNodeAffinity(topology).withPhase(v1.VolumeBound).PersistentVolume
+		pv.Spec.PersistentVolumeReclaimPolicy = v1.PersistentVolumeReclaimDelete
+		claim := makePVC(name+"-data", waitSC.Name).withBoundPV(pv.Name).withPhase(v1.ClaimBound).PersistentVolumeClaim
+		claim.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(pod, v1.SchemeGroupVersion.WithKind("Pod"))}
+		return pod, claim, pv
+	}
+	victimA, victimAPVC, victimAPV := victim("victim-a", zoneNodes[0].Name, "25Gi", map[string][]string{
+		"topology.kubernetes.io/zone": {"zone-a"},
+	})
+	victimB := makePod("victim-b").withNodeName(zoneNodes[0].Name).withPriority(200).Pod
+	victimC, victimCPVC, victimCPV := victim("victim-c", poolNodes[0].Name, "20Gi", map[string][]string{
+		"pool-y": {"true"},
+	})
+	terminatingA := victimA.DeepCopy()
+	terminatingA.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	terminatingB := victimB.DeepCopy()
+	terminatingB.Spec.Priority = pointer.Int32Ptr(0)
+	terminatingB.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	releasedPV := makePV("pv-released", waitSC.Name).withCapacity(resource.MustParse("25Gi")).withNodeAffinity(map[string][]string{
+		"topology.kubernetes.io/zone": {"zone-a"},
+	}).withPhase(v1.VolumeReleased).PersistentVolume
+	releasedPV.UID = "pv-released-uid"
+	releasedPV.Spec.PersistentVolumeReclaimPolicy = v1.PersistentVolumeReclaimDelete
+
+	table := []struct {
+		name          string
+		nodes         []*v1.Node
+		cscs          []*storagev1beta1.CSIStorageCapacity
+		pvcs          []*v1.PersistentVolumeClaim
+		pvs           []*v1.PersistentVolume
+		pods          []*v1.Pod
+		pdbs          []*policyv1.PodDisruptionBudget
+		nominatedNode string
+		expectNode    string
+		expectRemains []string
+	}{
+		{
+			name:          "lower priority pod frees the capacity",
+			nodes:         zoneNodes,
+			cscs:          zoneCSCs,
+			pvcs:          []*v1.PersistentVolumeClaim{pvc, victimAPVC},
+			pvs:           []*v1.PersistentVolume{victimAPV},
+			pods:          []*v1.Pod{victimA, victimB},
+			expectNode:    zoneNodes[0].Name,
+			expectRemains: []string{victimB.Name},
+		},
+		{
+			name:  "pod disruption budget doesn't allow the disruption",
+			nodes: zoneNodes,
+			cscs:  zoneCSCs,
+			pvcs:  []*v1.PersistentVolumeClaim{pvc, victimAPVC},
+			pvs:   []*v1.PersistentVolume{victimAPV},
+			pods:  []*v1.Pod{victimA, victimB},
+			pdbs: []*policyv1.PodDisruptionBudget{{
+				ObjectMeta: metav1.ObjectMeta{Name: "pdb-a", Namespace: v1.NamespaceDefault},
+				Spec:       policyv1.PodDisruptionBudgetSpec{Selector: metav1.SetAsLabelSelector(victimA.Labels)},
+				Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 0},
+			}},
+			expectRemains: []string{victimA.Name, victimB.Name},
+		},
+		{
+			name:          "capacity of terminating pod is being freed",
+			nodes:         zoneNodes,
+			cscs:          zoneCSCs,
+			pvcs:          []*v1.PersistentVolumeClaim{pvc, victimAPVC},
+			pvs:           []*v1.PersistentVolume{victimAPV},
+			pods:          []*v1.Pod{terminatingA, victimB},
+			expectNode:    zoneNodes[0].Name,
+			expectRemains: []string{terminatingA.Name, victimB.Name},
+		},
+		{
+			name:          "capacity of released volume is being freed",
+			nodes:         zoneNodes,
+			cscs:          zoneCSCs,
+			pvcs:          []*v1.PersistentVolumeClaim{pvc, victimAPVC},
+			pvs:           []*v1.PersistentVolume{victimAPV, releasedPV},
+			pods:          []*v1.Pod{victimA, victimB},
+			expectNode:    zoneNodes[0].Name,
+			expectRemains: []string{victimA.Name, victimB.Name},
+		},
+		{
+			name:          "victims on the nominated node are terminating",
+			nodes:         zoneNodes,
+			cscs:          zoneCSCs,
+			pvcs:          []*v1.PersistentVolumeClaim{pvc, victimAPVC},
+			pvs:           []*v1.PersistentVolume{victimAPV},
+			pods:          []*v1.Pod{victimA, terminatingB},
+			nominatedNode: zoneNodes[0].Name,
+			expectRemains: []string{victimA.Name, terminatingB.Name},
+		},
+		{
+			name:          "capacity freed in another object is not enough",
+			nodes:         poolNodes,
+			cscs:          poolCSCs,
+			pvcs:          []*v1.PersistentVolumeClaim{pvc, victimCPVC},
+			pvs:           []*v1.PersistentVolume{victimCPV},
+			pods:          []*v1.Pod{victimC},
+			expectRemains: []string{victimC.Name},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tester, err := newPluginTester(t, ctx, item.nodes, item.pvcs, item.pvs, item.cscs, &config.StorageCapacityPrioritizationArgs{
+				EnablePreemption: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tester.registerPlugin(t)
+			for _, p := range item.pods {
+				if _, err := tester.plugin.clientSet.CoreV1().Pods(p.Namespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+				for _, nodeInfo := range tester.nodeInfos {
+					if nodeInfo.Node().Name == p.Spec.NodeName {
+						nodeInfo.AddPod(p)
+					}
+				}
+			}
+			tester.plugin.sharedLister = nodeInfoLister(tester.nodeInfos)
+			pdbIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, pdb := range item.pdbs {
+				if err := pdbIndexer.Add(pdb); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tester.plugin.pdbLister = policylisters.NewPodDisruptionBudgetLister(pdbIndexer)
+
+			pod := makePod("pod-a").withPriority(100).withPVCVolume(pvc.Name, "").Pod
+			pod.Status.NominatedNodeName = item.nominatedNode
+			state := framework.NewCycleState()
+			tester.PreFilter(t, ctx, pod, state, nil)
+			statuses := framework.NodeToStatusMap{}
+			for _, nodeInfo := range tester.nodeInfos {
+				status := tester.plugin.Filter(ctx, state, pod, nodeInfo)
+				if status.IsSuccess() {
+					t.Fatalf("filter status does not match got: %v, want: %v", status, framework.UnschedulableAndUnresolvable)
+				}
+				statuses[nodeInfo.Node().Name] = status.WithFailedPlugin(Name)
+			}
+			s, err := getStateData(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectClassNames := s.storageClassNames.List()
+			expectRejections := map[string]storageClassRejections{}
+			for className, r := range s.rejections {
+				expectRejections[className] = *r
+			}
+
+			result, status := tester.plugin.PostFilter(ctx, state, pod, statuses)
+			if got := s.storageClassNames.List(); !reflect.DeepEqual(got, expectClassNames) {
+				t.Errorf("the dry run of the preemption changed the storage class names got: %v, want: %v", got, expectClassNames)
+			}
+			gotRejections := map[string]storageClassRejections{}
+			for className, r := range s.rejections {
+				gotRejections[className] = *r
+			}
+			if !reflect.DeepEqual(gotRejections, expectRejections) {
+				t.Errorf("the dry run of the preemption changed the rejections got: %+v, want: %+v", gotRejections, expectRejections)
+			}
+			if item.expectNode == "" {
+				if status.Code() != framework.Unschedulable {
+					t.Errorf("post filter status does not match got: %v, want: %v", status, framework.Unschedulable)
+				}
+			} else {
+				if !status.IsSuccess() {
+					t.Fatalf("post filter status does not match got: %v, want: %v", status, framework.Success)
+				}
+				if result == nil || result.NominatedNodeName != item.expectNode {
+					t.Errorf("nominated node does not match got: %+v, want: %q", result, item.expectNode)
+				}
+			}
+			pods, err := tester.plugin.clientSet.CoreV1().Pods(v1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := sets.NewString()
+			for _, p := range pods.Items {
+				got.Insert(p.Name)
+			}
+			if expect := sets.NewString(item.expectRemains...); !got.Equal(expect) {
+				t.Errorf("remaining pods do not match got: %v, want: %v", got.List(), expect.List())
+			}
+		})
+	}
+}
+
+func TestStorageCapacityPrioritizationPostFilterPreemptNever(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvc}, nil, cscs, &config.StorageCapacityPrioritizationArgs{
+		EnablePreemption: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester.registerPlugin(t)
+	tester.plugin.sharedLister = nodeInfoLister(tester.nodeInfos)
+
+	pod := makePod("pod-a").withPriority(100).withPVCVolume(pvc.Name, "").Pod
+	pod.Spec.PreemptionPolicy = func() *v1.PreemptionPolicy { p := v1.PreemptNever; return &p }()
+	state := framework.NewCycleState()
+	tester.PreFilter(t, ctx, pod, state, nil)
+	statuses := framework.NodeToStatusMap{
+		nodes[0].Name: tester.plugin.Filter(ctx, state, pod, tester.nodeInfos[0]).WithFailedPlugin(Name),
+	}
+	if _, status := tester.plugin.PostFilter(ctx, state, pod, statuses); status.Code() != framework.Unschedulable {
+		t.Errorf("post filter status does not match got: %v, want: %v", status, framework.Unschedulable)
+	}
+}
+
+func TestStorageCapacityPrioritizationPostBind(t *testing.T) {
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("25Gi")).PersistentVolumeClaim
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+		makeNode("zone-b-node-a").withLabel("topology.kubernetes.io/zone", "zone-b").Node,
+		makeNode("zone-c-node-a").withLabel("topology.kubernetes.io/zone", "zone-c").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("100Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+		makeCSC("2", waitSC.Name).withCapacity(resource.MustParse("50Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-b",
+		})).CSIStorageCapacity,
+		makeCSC("3", waitSC.Name).withCapacity(resource.MustParse("40Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-c",
+		})).CSIStorageCapacity,
+	}
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+	score := func(s int64) *int64 {
+		return &s
+	}
+	classScoresC := []*classScore{
+		{StorageClassName: waitSC.Name, CSIStorageCapacities: []string{"default/csisc-3"}, Requested: gi("25Gi"), Capacity: gi("40Gi"), Usage: 0.625, Score: 62.5, Weight: 1},
+	}
+	classScoresA := []*classScore{
+		{StorageClassName: waitSC.Name, CSIStorageCapacities: []string{"default/csisc-1"}, Requested: gi("25Gi"), Capacity: gi("100Gi"), Usage: 0.25, Score: 25, Weight: 1},
+	}
+
+	table := []struct {
+		name   string
+		args   *config.StorageCapacityPrioritizationArgs
+		expect scoreExplanation
+	}{
+		{
+			name: "scores are explained",
+			args: &config.StorageCapacityPrioritizationArgs{ScoreExplanationNodes: 1},
+			expect: scoreExplanation{
+				SelectedNode: "zone-a-node-a",
+				Nodes: []*nodeScoreExplanation{
+					{Node: "zone-c-node-a", Score: 62, StorageClasses: classScoresC},
+					{Node: "zone-a-node-a", Score: 25, StorageClasses: classScoresA},
+				},
+			},
+		},
+		{
+			name: "normalized scores are explained",
+			args: &config.StorageCapacityPrioritizationArgs{ScoreExplanationNodes: 1, ScoreNormalization: config.MinMaxScoreNormalization},
+			expect: scoreExplanation{
+				SelectedNode: "zone-a-node-a",
+				Nodes: []*nodeScoreExplanation{
+					{Node: "zone-c-node-a", Score: 100, ScoreBeforeNormalization: score(62), StorageClasses: classScoresC},
+					{Node: "zone-a-node-a", Score: 0, ScoreBeforeNormalization: score(25), StorageClasses: classScoresA},
+				},
+			},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvc}, nil, cscs, item.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod := makePod("pod-a").withPVCVolume(pvc.Name, "").Pod
+			if _, err := tester.framework.ClientSet().CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			state := framework.NewCycleState()
+			tester.PreFilter(t, ctx, pod, state, nil)
+			tester.Filter(t, ctx, pod, state, []*framework.Status{nil, nil, nil})
+			tester.filteredNodeInfos = tester.nodeInfos
+			tester.PreScore(t, ctx, pod, state, nil)
+			scores := framework.NodeScoreList{}
+			for _, node := range nodes {
+				s, status := tester.plugin.Score(ctx, state, pod, node.Name)
+				if !status.IsSuccess() {
+					t.Fatal(status.AsError())
+				}
+				scores = append(scores, framework.NodeScore{Name: node.Name, Score: s})
+			}
+			if extensions := tester.plugin.ScoreExtensions(); extensions != nil {
+				if status := extensions.NormalizeScore(ctx, state, pod, scores); !status.IsSuccess() {
+					t.Fatal(status.AsError())
+				}
+			}
+			tester.plugin.PostBind(ctx, state, pod, "zone-a-node-a")
+
+			got, err := tester.framework.ClientSet().CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var explanation scoreExplanation
+			if err := json.Unmarshal([]byte(got.Annotations[scoreExplanationAnnotation]), &explanation); err != nil {
+				t.Fatalf("failed to unmarshal the score explanation %q: %v", got.Annotations[scoreExplanationAnnotation], err)
+			}
+			if !reflect.DeepEqual(explanation, item.expect) {
+				t.Errorf("score explanation does not match got: %s, want: %+v", got.Annotations[scoreExplanationAnnotation], item.expect)
+			}
+		})
+	}
+}
+
+func TestStorageCapacityPrioritizationFilterMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pvc := makePVC("pvc-a", waitSC.Name).withRequestStorage(resource.MustParse("30Gi")).PersistentVolumeClaim
+	nodes := []*v1.Node{
+		makeNode("zone-a-node-a").withLabel("topology.kubernetes.io/zone", "zone-a").Node,
+	}
+	cscs := []*storagev1beta1.CSIStorageCapacity{
+		makeCSC("1", waitSC.Name).withCapacity(resource.MustParse("10Gi")).withTopology(labels.Set(map[string]string{
+			"topology.kubernetes.io/zone": "zone-a",
+		})).CSIStorageCapacity,
+	}
+	tester, err := newPluginTester(t, ctx, nodes, []*v1.PersistentVolumeClaim{pvc}, nil, cscs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := filteredNodes.WithLabelValues(waitSC.Name, reasonInsufficientCapacity)
+	before, err := testutil.GetCounterMetricValue(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := makePod("pod-a").withPVCVolume(pvc.Name, "").Pod
+	state := framework.NewCycleState()
+	tester.PreFilter(t, ctx, pod, state, nil)
+	if status := tester.plugin.Filter(ctx, state, pod, tester.nodeInfos[0]); status.IsSuccess() {
+		t.Fatalf("filter status does not match got: %v, want: %v", status, framework.UnschedulableAndUnresolvable)
+	}
+	after, err := testutil.GetCounterMetricValue(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after-before != 1 {
+		t.Errorf("filtered nodes metric does not match got: %v, want: %v", after-before, 1)
+	}
+}
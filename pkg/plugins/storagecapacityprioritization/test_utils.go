@@ -10,6 +10,8 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
 	"k8s.io/utils/pointer"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/storagecapacity"
 )
 
 type nodeBuilder struct {
@@ -153,6 +155,11 @@ func (pb podBuilder) withNamespace(name string) podBuilder {
 	return pb
 }
 
+func (pb podBuilder) withPriority(priority int32) podBuilder {
+	pb.Pod.Spec.Priority = pointer.Int32Ptr(priority)
+	return pb
+}
+
 func (pb podBuilder) withPVCVolume(pvcName, name string) podBuilder {
 	pb.Pod.Spec.Volumes = append(pb.Pod.Spec.Volumes, v1.Volume{
 		Name: name,
@@ -165,6 +172,20 @@ func (pb podBuilder) withPVCVolume(pvcName, name string) podBuilder {
 	return pb
 }
 
+func (pb podBuilder) withEphemeralVolume(name string, spec v1.PersistentVolumeClaimSpec) podBuilder {
+	pb.Pod.Spec.Volumes = append(pb.Pod.Spec.Volumes, v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{
+			Ephemeral: &v1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &v1.PersistentVolumeClaimTemplate{
+					Spec: spec,
+				},
+			},
+		},
+	})
+	return pb
+}
+
 func (pb podBuilder) withPVCSVolume(pvcs []*v1.PersistentVolumeClaim) podBuilder {
 	for i, pvc := range pvcs {
 		pb.withPVCVolume(pvc.Name, fmt.Sprintf("vol%v", i))
@@ -214,3 +235,12 @@ func (csc cscBuilder) withTopology(ls labels.Set) cscBuilder {
 	csc.NodeTopology = metav1.SetAsLabelSelector(ls)
 	return csc
 }
+
+func (csc cscBuilder) withMaximumVolumeSize(size resource.Quantity) cscBuilder {
+	csc.MaximumVolumeSize = &size
+	return csc
+}
+
+func (csc cscBuilder) toCapacity() *csiStorageCapacity {
+	return storagecapacity.NewFromV1beta1(csc.CSIStorageCapacity)
+}
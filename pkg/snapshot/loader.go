@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// Read reads the archive written by Write. YAML is accepted as well.
+func Read(r io.Reader) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeArchive(data)
+}
+
+func decodeArchive(data []byte) (*Archive, error) {
+	archive := &Archive{}
+	if err := yaml.Unmarshal(data, archive); err != nil {
+		return nil, err
+	}
+	if archive.Version != Version {
+		return nil, fmt.Errorf("unsupported archive version %q, want %q", archive.Version, Version)
+	}
+	return archive, nil
+}
+
+// Objects returns the objects of the archive.
+func (a *Archive) Objects() []runtime.Object {
+	var objects []runtime.Object
+	for i := range a.Nodes {
+		objects = append(objects, &a.Nodes[i])
+	}
+	for i := range a.StorageClasses {
+		objects = append(objects, &a.StorageClasses[i])
+	}
+	for i := range a.CSIDrivers {
+		objects = append(objects, &a.CSIDrivers[i])
+	}
+	for i := range a.CSIStorageCapacities {
+		objects = append(objects, &a.CSIStorageCapacities[i])
+	}
+	for i := range a.PersistentVolumes {
+		objects = append(objects, &a.PersistentVolumes[i])
+	}
+	for i := range a.PersistentVolumeClaims {
+		objects = append(objects, &a.PersistentVolumeClaims[i])
+	}
+	for i := range a.Pods {
+		objects = append(objects, &a.Pods[i])
+	}
+	return objects
+}
+
+// NewClientset returns a fake clientset serving the objects of the archive.
+func (a *Archive) NewClientset() *fake.Clientset {
+	return fake.NewSimpleClientset(a.Objects()...)
+}
+
+// NewInformerFactory returns an informer factory of a fake clientset serving
+// the objects of the archive. The informers have to be started by the caller
+// after they are requested, as with the informer factory of a scheduler.
+func (a *Archive) NewInformerFactory() (informers.SharedInformerFactory, *fake.Clientset) {
+	client := a.NewClientset()
+	return informers.NewSharedInformerFactory(client, 0), client
+}
+
+// LoadObjects reads the objects from the file, which is either an archive or
+// a YAML or JSON stream of Kubernetes objects separated by "---", e.g. the
+// output of kubectl get. The Lists in the stream are expanded, and the
+// storage.k8s.io/v1 CSIStorageCapacities are read as v1beta1, which has the
+// same fields.
+func LoadObjects(path string) ([]runtime.Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(data, &header); err == nil && header.Kind == "" && header.Version != "" {
+		archive, err := decodeArchive(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %v", path, err)
+		}
+		return archive.Objects(), nil
+	}
+
+	var objects []runtime.Object
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		raw := runtime.RawExtension{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read %q: %v", path, err)
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(raw.Raw); err != nil {
+			return nil, fmt.Errorf("failed to read %q: %v", path, err)
+		}
+		objs, err := toObjects(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %v", path, err)
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+func toObjects(u *unstructured.Unstructured) ([]runtime.Object, error) {
+	if u.IsList() {
+		list, err := u.ToList()
+		if err != nil {
+			return nil, err
+		}
+		var objects []runtime.Object
+		for i := range list.Items {
+			objs, err := toObjects(&list.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, objs...)
+		}
+		return objects, nil
+	}
+
+	gvk := u.GroupVersionKind()
+	if gvk.Group == storagev1beta1.GroupName && gvk.Kind == "CSIStorageCapacity" {
+		u.SetAPIVersion(storagev1beta1.SchemeGroupVersion.String())
+	}
+	obj, err := clientgoscheme.Scheme.New(u.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+		return nil, err
+	}
+	return []runtime.Object{obj}, nil
+}
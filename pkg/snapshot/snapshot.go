@@ -0,0 +1,160 @@
+// Package snapshot records the objects which the StorageCapacityPrioritization
+// plugin reads from a cluster into an archive, and loads them back for the
+// tests and the simulator.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Version is the version of the archive format.
+const Version = "v1"
+
+var csiStorageCapacityV1 = schema.GroupVersionResource{
+	Group:    storagev1beta1.GroupName,
+	Version:  "v1",
+	Resource: "csistoragecapacities",
+}
+
+// Archive is the state of a cluster which the plugin reads.
+type Archive struct {
+	// Version is the version of the archive format.
+	Version string `json:"version"`
+	// CreationTimestamp is the time when the archive is recorded.
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+
+	Nodes          []v1.Node                `json:"nodes,omitempty"`
+	StorageClasses []storagev1.StorageClass `json:"storageClasses,omitempty"`
+	CSIDrivers     []storagev1.CSIDriver    `json:"csiDrivers,omitempty"`
+	// CSIStorageCapacities are recorded as v1beta1, which has the same fields
+	// as v1, regardless of the version served by the cluster.
+	CSIStorageCapacities []storagev1beta1.CSIStorageCapacity `json:"csiStorageCapacities,omitempty"`
+	PersistentVolumes    []v1.PersistentVolume               `json:"persistentVolumes,omitempty"`
+	// PersistentVolumeClaims are the claims which are not bound yet, and the
+	// claims which the pods reference.
+	PersistentVolumeClaims []v1.PersistentVolumeClaim `json:"persistentVolumeClaims,omitempty"`
+	// Pods are the pods which are not scheduled yet, and the pods bound to
+	// the nodes.
+	Pods []v1.Pod `json:"pods,omitempty"`
+}
+
+// Record records the objects of the cluster into an archive.
+// The CSIStorageCapacities are read with the dynamic client when the cluster
+// doesn't serve storage.k8s.io/v1beta1 anymore. dynamicClient may be nil for
+// the clusters serving v1beta1.
+func Record(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface) (*Archive, error) {
+	archive := &Archive{
+		Version:           Version,
+		CreationTimestamp: metav1.Now(),
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	archive.Nodes = nodes.Items
+
+	classes, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %v", err)
+	}
+	archive.StorageClasses = classes.Items
+
+	drivers, err := client.StorageV1().CSIDrivers().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list csi drivers: %v", err)
+	}
+	archive.CSIDrivers = drivers.Items
+
+	archive.CSIStorageCapacities, err = listCSIStorageCapacities(ctx, client, dynamicClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list csi storage capacities: %v", err)
+	}
+
+	pvs, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %v", err)
+	}
+	archive.PersistentVolumes = pvs.Items
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	archive.Pods = pods.Items
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %v", err)
+	}
+	referenced := referencedClaims(archive.Pods)
+	for _, pvc := range pvcs.Items {
+		if pvc.Status.Phase == v1.ClaimPending || referenced.Has(pvc.Namespace+"/"+pvc.Name) {
+			archive.PersistentVolumeClaims = append(archive.PersistentVolumeClaims, pvc)
+		}
+	}
+	return archive, nil
+}
+
+// referencedClaims returns the namespaced names of the claims which the pods
+// reference, including the claims of the generic ephemeral volumes.
+func referencedClaims(pods []v1.Pod) sets.String {
+	names := sets.NewString()
+	for _, pod := range pods {
+		for _, vol := range pod.Spec.Volumes {
+			switch {
+			case vol.PersistentVolumeClaim != nil:
+				names.Insert(pod.Namespace + "/" + vol.PersistentVolumeClaim.ClaimName)
+			case vol.Ephemeral != nil:
+				names.Insert(pod.Namespace + "/" + pod.Name + "-" + vol.Name)
+			}
+		}
+	}
+	return names
+}
+
+func listCSIStorageCapacities(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface) ([]storagev1beta1.CSIStorageCapacity, error) {
+	capacities, err := client.StorageV1beta1().CSIStorageCapacities(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err == nil {
+		return capacities.Items, nil
+	}
+	if !apierrors.IsNotFound(err) || dynamicClient == nil {
+		return nil, err
+	}
+
+	list, err := dynamicClient.Resource(csiStorageCapacityV1).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]storagev1beta1.CSIStorageCapacity, 0, len(list.Items))
+	for _, item := range list.Items {
+		capacity := storagev1beta1.CSIStorageCapacity{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &capacity); err != nil {
+			return nil, err
+		}
+		capacity.APIVersion = storagev1beta1.SchemeGroupVersion.String()
+		result = append(result, capacity)
+	}
+	return result, nil
+}
+
+// Write writes the archive as JSON.
+func Write(w io.Writer, archive *Archive) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
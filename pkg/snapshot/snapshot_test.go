@@ -0,0 +1,128 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	capacity := resource.MustParse("10Gi")
+	client := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "sc-a"}, Provisioner: "driver-a"},
+		&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "driver-a"}},
+		&storagev1beta1.CSIStorageCapacity{ObjectMeta: metav1.ObjectMeta{Name: "csc-a", Namespace: "ns"}, StorageClassName: "sc-a", Capacity: &capacity},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "ns"}, Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimPending}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "bound", Namespace: "ns"}, Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "scheduled-data", Namespace: "ns"}, Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound}},
+		&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "unused", Namespace: "ns"}, Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "unscheduled", Namespace: "ns"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "scheduled", Namespace: "ns"}, Spec: v1.PodSpec{
+			NodeName: "node-a",
+			Volumes: []v1.Volume{
+				{Name: "a", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "bound"}}},
+				{Name: "data", VolumeSource: v1.VolumeSource{Ephemeral: &v1.EphemeralVolumeSource{}}},
+			},
+		}},
+	)
+
+	archive, err := Record(context.Background(), client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := Write(buf, archive); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Version != Version {
+		t.Errorf("version does not match got: %q, want: %q", got.Version, Version)
+	}
+	if len(got.Nodes) != 1 || len(got.StorageClasses) != 1 || len(got.CSIDrivers) != 1 || len(got.CSIStorageCapacities) != 1 {
+		t.Errorf("objects do not match got: %+v", got)
+	}
+	claimNames := sets.NewString()
+	for _, claim := range got.PersistentVolumeClaims {
+		claimNames.Insert(claim.Name)
+	}
+	if expect := sets.NewString("pending", "bound", "scheduled-data"); !claimNames.Equal(expect) {
+		t.Errorf("claims do not match got: %v, want: %v", claimNames.List(), expect.List())
+	}
+	podNames := sets.NewString()
+	for _, pod := range got.Pods {
+		podNames.Insert(pod.Name)
+	}
+	if expect := sets.NewString("unscheduled", "scheduled"); !podNames.Equal(expect) {
+		t.Errorf("pods do not match got: %v, want: %v", podNames.List(), expect.List())
+	}
+	if len(got.Objects()) != 9 {
+		t.Errorf("number of objects does not match got: %d, want: %d", len(got.Objects()), 9)
+	}
+}
+
+func TestReadUnsupportedVersion(t *testing.T) {
+	if _, err := Read(bytes.NewBufferString(`{"version": "v0"}`)); err == nil {
+		t.Error("error is expected for an unsupported version")
+	}
+}
+
+func TestLoadObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "objects.yaml")
+	data := `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: node-a
+- apiVersion: storage.k8s.io/v1
+  kind: StorageClass
+  metadata:
+    name: sc-a
+  provisioner: driver-a
+---
+apiVersion: storage.k8s.io/v1
+kind: CSIStorageCapacity
+metadata:
+  name: csc-a
+  namespace: ns
+storageClassName: sc-a
+capacity: 10Gi
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := LoadObjects(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("number of objects does not match got: %d, want: %d", len(objects), 3)
+	}
+	if _, ok := objects[0].(*v1.Node); !ok {
+		t.Errorf("object type does not match got: %T, want: %T", objects[0], &v1.Node{})
+	}
+	capacity, ok := objects[2].(*storagev1beta1.CSIStorageCapacity)
+	if !ok {
+		t.Fatalf("object type does not match got: %T, want: %T", objects[2], &storagev1beta1.CSIStorageCapacity{})
+	}
+	if capacity.Capacity == nil || capacity.Capacity.String() != "10Gi" {
+		t.Errorf("capacity does not match got: %v, want: %q", capacity.Capacity, "10Gi")
+	}
+}
@@ -0,0 +1,118 @@
+// Package storagecapacity evaluates whether the CSIStorageCapacity objects of
+// the storage classes have enough capacity on a node for the claims to be
+// provisioned, and scores the nodes by the capacity, in the same way as the
+// StorageCapacityPrioritization plugin.
+// It needs neither a running scheduler nor a cluster: all the objects are
+// given by the caller, so that other schedulers and tools can reuse the
+// evaluation.
+package storagecapacity
+
+import (
+	v1 "k8s.io/api/core/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// CSIStorageCapacity is the version neutral representation of the CSIStorageCapacity
+// object which is served as storage.k8s.io/v1 or storage.k8s.io/v1beta1.
+// The json tags are shared by both versions.
+type CSIStorageCapacity struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	StorageClassName  string                `json:"storageClassName"`
+	NodeTopology      *metav1.LabelSelector `json:"nodeTopology,omitempty"`
+	Capacity          *resource.Quantity    `json:"capacity,omitempty"`
+	MaximumVolumeSize *resource.Quantity    `json:"maximumVolumeSize,omitempty"`
+
+	// selector is NodeTopology compiled when the object is converted.
+	// It's nil when NodeTopology is nil or invalid.
+	selector labels.Selector
+	// usedBytes is UsedCapacityAnnotation parsed when the object is
+	// converted. It's negative when the annotation is not set or invalid.
+	usedBytes int64
+}
+
+// UsedCapacityAnnotation is the annotation of a CSIStorageCapacity object
+// which tells the data actually written to its pool, e.g. the used data of a
+// thin pool reported by the CSI driver. The published capacity of a thin pool
+// is its free space, so the size of the pool is the capacity and the used
+// capacity.
+const UsedCapacityAnnotation = "storage-capacity-prioritization.bells17.io/used-capacity"
+
+func (c *CSIStorageCapacity) parseUsedBytes() {
+	c.usedBytes = -1
+	value, ok := c.Annotations[UsedCapacityAnnotation]
+	if !ok {
+		return
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() < 0 {
+		klog.ErrorS(err, "Ignoring invalid used capacity annotation", "csiStorageCapacity", klog.KObj(c), "value", value)
+		return
+	}
+	c.usedBytes = quantity.Value()
+}
+
+// UsedBytes returns the used capacity annotated on the object, or -1 when
+// it's not known.
+func (c *CSIStorageCapacity) UsedBytes() int64 {
+	return c.usedBytes
+}
+
+func (c *CSIStorageCapacity) compileSelector() {
+	if c.NodeTopology == nil {
+		return
+	}
+	selector, err := metav1.LabelSelectorAsSelector(c.NodeTopology)
+	if err != nil {
+		// This should never happen because NodeTopology must be valid.
+		klog.ErrorS(err, "Unexpected error converting to a label selector", "nodeTopology", c.NodeTopology)
+		return
+	}
+	c.selector = selector
+}
+
+// Selector returns NodeTopology compiled when the object is converted.
+// It's nil when NodeTopology is nil or invalid.
+func (c *CSIStorageCapacity) Selector() labels.Selector {
+	return c.selector
+}
+
+// NewFromV1beta1 converts a storage.k8s.io/v1beta1 CSIStorageCapacity object.
+func NewFromV1beta1(capacity *storagev1beta1.CSIStorageCapacity) *CSIStorageCapacity {
+	c := &CSIStorageCapacity{
+		ObjectMeta:        capacity.ObjectMeta,
+		StorageClassName:  capacity.StorageClassName,
+		NodeTopology:      capacity.NodeTopology,
+		Capacity:          capacity.Capacity,
+		MaximumVolumeSize: capacity.MaximumVolumeSize,
+	}
+	c.compileSelector()
+	c.parseUsedBytes()
+	return c
+}
+
+// NewFromUnstructured converts a CSIStorageCapacity object of either version
+// read by a dynamic client. The fields of storage.k8s.io/v1 are the same as
+// storage.k8s.io/v1beta1, so the object is decoded as v1beta1.
+func NewFromUnstructured(obj *unstructured.Unstructured) (*CSIStorageCapacity, error) {
+	capacity := &storagev1beta1.CSIStorageCapacity{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), capacity); err != nil {
+		return nil, err
+	}
+	return NewFromV1beta1(capacity), nil
+}
+
+// NodeHasAccess reports whether the node is in the topology of the capacity.
+func NodeHasAccess(node *v1.Node, capacity *CSIStorageCapacity) bool {
+	if capacity.selector == nil {
+		// Unavailable, or NodeTopology is invalid.
+		return false
+	}
+	// Only matching by label is supported.
+	return capacity.selector.Matches(labels.Set(node.Labels))
+}
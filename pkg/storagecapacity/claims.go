@@ -0,0 +1,77 @@
+package storagecapacity
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ClaimGroup is the claims of a storage class which are going to be
+// provisioned on the same node.
+type ClaimGroup []*v1.PersistentVolumeClaim
+
+// TotalRequest returns the capacity requested by all the claims.
+func (cg ClaimGroup) TotalRequest() (int64, error) {
+	total := resource.Quantity{}
+	for _, claim := range cg {
+		quantity, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		if !ok {
+			return 0, fmt.Errorf("claim %s/%s does't have a resource request", claim.GetName(), claim.GetNamespace())
+		}
+		total.Add(quantity)
+	}
+	return total.Value(), nil
+}
+
+// Sizes returns the capacity requested by every claim.
+func (cg ClaimGroup) Sizes() ([]int64, error) {
+	sizes := make([]int64, 0, len(cg))
+	for _, claim := range cg {
+		quantity, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		if !ok {
+			return nil, fmt.Errorf("claim %s/%s does't have a resource request", claim.GetName(), claim.GetNamespace())
+		}
+		sizes = append(sizes, quantity.Value())
+	}
+	return sizes, nil
+}
+
+// LargestClaim returns the claim which requests the largest capacity.
+func (cg ClaimGroup) LargestClaim() (*v1.PersistentVolumeClaim, int64, error) {
+	var largest *v1.PersistentVolumeClaim
+	var largestSize int64
+	for _, claim := range cg {
+		quantity, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		if !ok {
+			return nil, 0, fmt.Errorf("claim %s/%s does't have a resource request", claim.GetName(), claim.GetNamespace())
+		}
+		if largest == nil || quantity.Value() > largestSize {
+			largest = claim
+			largestSize = quantity.Value()
+		}
+	}
+	return largest, largestSize, nil
+}
+
+// ClaimsByStorageClass is the claim groups keyed by the storage class name.
+type ClaimsByStorageClass map[string]ClaimGroup
+
+// GroupByStorageClass groups the claims by the storage class name.
+func GroupByStorageClass(claims []*v1.PersistentVolumeClaim) ClaimsByStorageClass {
+	groups := ClaimsByStorageClass{}
+	for _, claim := range claims {
+		className := StorageClassName(claim)
+		groups[className] = append(groups[className], claim)
+	}
+	return groups
+}
+
+// StorageClassName returns the storage class name of the claim, or an empty
+// string when it's not set.
+func StorageClassName(claim *v1.PersistentVolumeClaim) string {
+	if claim.Spec.StorageClassName == nil {
+		return ""
+	}
+	return *claim.Spec.StorageClassName
+}
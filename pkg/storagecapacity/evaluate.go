@@ -0,0 +1,338 @@
+package storagecapacity
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+// The types of Reason.
+const (
+	ReasonInsufficientCapacity     = "insufficient_capacity"
+	ReasonExceedsMaximumVolumeSize = "exceeds_maximum_volume_size"
+	ReasonStorageClassNotFound     = "storage_class_not_found"
+	ReasonNodeNotCovered           = "node_not_covered"
+)
+
+// Reason is the reason why the claims of a storage class can't be
+// provisioned on a node.
+type Reason struct {
+	StorageClassName string `json:"storageClassName"`
+	// Type is one of the Reason constants.
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// Requested is the bytes requested by the claims of the storage class.
+	Requested int64 `json:"requested"`
+	// Available is the capacity available on the node.
+	Available int64 `json:"available"`
+}
+
+// ClassCapacities is the snapshot of the CSIStorageCapacity objects of a
+// storage class.
+type ClassCapacities struct {
+	// Tracked reports whether the CSI driver of the storage class publishes
+	// the capacity with CSIStorageCapacity objects.
+	Tracked    bool
+	Capacities []*CSIStorageCapacity
+	// Policy adjusts the capacity of every object.
+	Policy Policy
+}
+
+// NewClassCapacities returns the snapshot of the CSIStorageCapacity objects
+// of the storage class. The capacity is not tracked when driver is nil, i.e.
+// the CSIDriver object is not found, or when the driver doesn't publish it.
+func NewClassCapacities(args *config.StorageCapacityPrioritizationArgs, class *storagev1.StorageClass, driver *storagev1.CSIDriver, capacities []*CSIStorageCapacity) *ClassCapacities {
+	if driver == nil || driver.Spec.StorageCapacity == nil || !*driver.Spec.StorageCapacity {
+		return &ClassCapacities{}
+	}
+	return &ClassCapacities{Tracked: true, Capacities: capacities, Policy: PolicyOf(args, class)}
+}
+
+// FindCapacity returns the capacity selected for the claim group on the node
+// when it's enough for the claim group. It returns nil without a reason when
+// the capacity of the storage class is not tracked by the CSI driver, or when
+// no CSIStorageCapacity object covers the node and UnknownCapacity allows it.
+func FindCapacity(args *config.StorageCapacityPrioritizationArgs, node *v1.Node, className string, cg ClaimGroup, capacities map[string]*ClassCapacities, assumed AssumedFunc) (*Selection, *Reason, error) {
+	classCapacities, ok := capacities[className]
+	if !ok {
+		return nil, &Reason{StorageClassName: className, Type: ReasonStorageClassNotFound, Message: fmt.Sprintf("storage class %q is not found", className)}, nil
+	}
+	if !classCapacities.Tracked {
+		return nil, nil, nil
+	}
+
+	sizeInBytes, err := cg.TotalRequest()
+	if err != nil {
+		return nil, nil, err
+	}
+	largest, largestSize, err := cg.LargestClaim()
+	if err != nil {
+		return nil, nil, err
+	}
+	var claimSizes []int64
+	if Packs(args.CapacityAggregation) {
+		if claimSizes, err = cg.Sizes(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	selection := selectFor(args.CapacityAggregation, node, className, classCapacities, sizeInBytes, largestSize, claimSizes, assumed)
+	if selection == nil && args.UnknownCapacity != "" && args.UnknownCapacity != config.RejectUnknownCapacity {
+		return nil, nil, nil
+	}
+	if selection == nil {
+		return nil, &Reason{
+			StorageClassName: className,
+			Type:             ReasonNodeNotCovered,
+			Message:          fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", node.GetName(), sizeInBytes),
+			Requested:        sizeInBytes,
+		}, nil
+	}
+	if selection.ExceedsMaximumVolumeSize {
+		return nil, &Reason{
+			StorageClassName: className,
+			Type:             ReasonExceedsMaximumVolumeSize,
+			Message:          fmt.Sprintf("claim %s/%s exceeds the maximum volume size of csi storage capacity objects. node=%q sizeInBytes=%d", largest.GetNamespace(), largest.GetName(), node.GetName(), largestSize),
+			Requested:        sizeInBytes,
+			Available:        selection.Available,
+		}, nil
+	}
+	if selection.Sufficient {
+		// Enough capacity found.
+		return selection, nil, nil
+	}
+	return nil, &Reason{
+		StorageClassName: className,
+		Type:             ReasonInsufficientCapacity,
+		Message:          fmt.Sprintf("there is nothing enough capacities of csi storage capacity objects. node=%q sizeInBytes=%d", node.GetName(), sizeInBytes),
+		Requested:        sizeInBytes,
+		Available:        selection.Available,
+	}, nil
+}
+
+// Packs reports whether the claims are packed into the CSIStorageCapacity
+// objects with the aggregation. Pack is the default aggregation, because the
+// claims of a storage class may land in different objects and each of them
+// must fit in one object.
+func Packs(aggregation config.CapacityAggregationType) bool {
+	return aggregation == "" || aggregation == config.PackCapacityAggregation
+}
+
+// selectFor selects the capacity of the storage class on the node with Pack
+// or Select according to the aggregation.
+func selectFor(aggregation config.CapacityAggregationType, node *v1.Node, className string, classCapacities *ClassCapacities, sizeInBytes, largestClaim int64, claimSizes []int64, assumed AssumedFunc) *Selection {
+	if Packs(aggregation) {
+		return Pack(node, className, classCapacities.Capacities, claimSizes, classCapacities.Policy, assumed)
+	}
+	return Select(aggregation, node, className, classCapacities.Capacities, sizeInBytes, largestClaim, classCapacities.Policy, assumed)
+}
+
+// ClassScore is the score of a storage class on a node.
+type ClassScore struct {
+	StorageClassName string `json:"storageClassName"`
+	// CSIStorageCapacities are the namespace/name of the CSIStorageCapacity
+	// objects the claims are provisioned from.
+	CSIStorageCapacities []string `json:"csiStorageCapacities,omitempty"`
+	// Requested and Capacity are the bytes the scorer is applied to.
+	Requested int64   `json:"requested"`
+	Capacity  int64   `json:"capacity"`
+	Usage     float64 `json:"usage"`
+	Score     float64 `json:"score"`
+	Weight    int64   `json:"weight"`
+}
+
+// CalculateScores returns the scores of the nodes, and the scores of the
+// storage classes on every node which the scores are calculated from.
+// The score of a node is the weighted average of the scores of the storage
+// classes, which is neither truncated nor normalized.
+func CalculateScores(args *config.StorageCapacityPrioritizationArgs, nodes []*v1.Node, storageClassNames []string, capacities map[string]*ClassCapacities, claims ClaimsByStorageClass, scorers map[string]ClassScorer, assumed AssumedFunc) (map[string]float64, map[string][]*ClassScore, error) {
+	capacityUsageMap := make(map[string][]*ClassScore) // map[nodeName][]ClassScore
+	for _, className := range storageClassNames {
+		claimGroup, ok := claims[className]
+		if !ok {
+			return nil, nil, fmt.Errorf("storage class %q is not found in claim groups", className)
+		}
+		request, err := claimGroup.TotalRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+		_, largestSize, err := claimGroup.LargestClaim()
+		if err != nil {
+			return nil, nil, err
+		}
+		claimSizes, err := claimGroup.Sizes()
+		if err != nil {
+			return nil, nil, err
+		}
+		classCapacities, ok := capacities[className]
+		if !ok {
+			continue
+		}
+		for _, node := range nodes {
+			selection := selectFor(args.CapacityAggregation, node, className, classCapacities, request, largestSize, claimSizes, assumed)
+			sc := &ClassScore{StorageClassName: className, Weight: scorers[className].Weight}
+			if selection == nil {
+				if !classCapacities.Tracked {
+					continue
+				}
+				var ok bool
+				if sc.Score, ok = unknownCapacityScore(args.UnknownCapacity); !ok {
+					continue
+				}
+			} else {
+				sc.Requested, sc.Capacity = selection.UsageOf(request, largestSize, args.ConsiderMaximumVolumeSize)
+				sc.Usage = Usage(sc.Requested, sc.Capacity)
+				sc.Score = scorers[className].Scorer(sc.Requested, sc.Capacity)
+				for _, allocation := range selection.Allocations {
+					sc.CSIStorageCapacities = append(sc.CSIStorageCapacities, allocation.Capacity.Namespace+"/"+allocation.Capacity.Name)
+				}
+			}
+			capacityUsageMap[node.GetName()] = append(capacityUsageMap[node.GetName()], sc)
+		}
+	}
+
+	nodeScores := map[string]float64{}
+	for nodeName, classScores := range capacityUsageMap {
+		var score float64
+		var weightSum int64
+		for _, sc := range classScores {
+			score += sc.Score * float64(sc.Weight)
+			weightSum += sc.Weight
+		}
+		// The storage classes of the weight 0 don't count in the node score.
+		if weightSum == 0 {
+			nodeScores[nodeName] = 0
+			continue
+		}
+		nodeScores[nodeName] = score / float64(weightSum)
+	}
+	return nodeScores, capacityUsageMap, nil
+}
+
+// unknownCapacityScore returns the score of a storage class on a node which
+// no CSIStorageCapacity object covers. It returns false when the node isn't
+// scored for the storage class.
+func unknownCapacityScore(policy config.UnknownCapacityPolicy) (float64, bool) {
+	switch policy {
+	case config.NeutralUnknownCapacity:
+		return float64(MaxNodeScore) / 2, true
+	case config.ZeroUnknownCapacity:
+		return 0, true
+	case config.MaxUnknownCapacity:
+		return float64(MaxNodeScore), true
+	}
+	return 0, false
+}
+
+// Input is the objects which Evaluate evaluates the claims against.
+type Input struct {
+	// Claims are the claims which are going to be dynamically provisioned.
+	// Finding the PersistentVolumes which they may be bound to instead is up
+	// to the caller.
+	Claims               []*v1.PersistentVolumeClaim
+	Nodes                []*v1.Node
+	StorageClasses       []*storagev1.StorageClass
+	CSIDrivers           []*storagev1.CSIDriver
+	CSIStorageCapacities []*CSIStorageCapacity
+	// Assumed is the capacity consumed but not reflected in the objects yet.
+	// It may be nil.
+	Assumed AssumedFunc
+}
+
+// NodeResult is the result of the evaluation of the claims on a node.
+type NodeResult struct {
+	Node string `json:"node"`
+	// Reasons are why the claims can't be provisioned on the node.
+	// The node is feasible when it's empty.
+	Reasons []*Reason `json:"reasons,omitempty"`
+	// Score is the score of the node. It's nil when the node is infeasible,
+	// or when no storage class is scored on the node.
+	Score *float64 `json:"score,omitempty"`
+	// StorageClasses are the scores of the storage classes the score is
+	// calculated from.
+	StorageClasses []*ClassScore `json:"storageClasses,omitempty"`
+}
+
+// Feasible reports whether the claims can be provisioned on the node.
+func (r *NodeResult) Feasible() bool {
+	return len(r.Reasons) == 0
+}
+
+// Evaluate evaluates whether the claims can be provisioned on every node, and
+// scores the feasible nodes, with the args of the plugin. The results are in
+// the order of the nodes.
+func Evaluate(args *config.StorageCapacityPrioritizationArgs, in *Input) ([]*NodeResult, error) {
+	scorers, err := NewClassScorers(args)
+	if err != nil {
+		return nil, err
+	}
+	classes := map[string]*storagev1.StorageClass{}
+	for _, class := range in.StorageClasses {
+		classes[class.Name] = class
+	}
+	drivers := map[string]*storagev1.CSIDriver{}
+	for _, driver := range in.CSIDrivers {
+		drivers[driver.Name] = driver
+	}
+
+	claims := GroupByStorageClass(in.Claims)
+	classNames := make([]string, 0, len(claims))
+	for className := range claims {
+		classNames = append(classNames, className)
+	}
+	sort.Strings(classNames)
+
+	var scoredClassNames []string
+	capacities := map[string]*ClassCapacities{}
+	classScorers := map[string]ClassScorer{}
+	for _, className := range classNames {
+		class, ok := classes[className]
+		if !ok {
+			continue
+		}
+		var classCapacities []*CSIStorageCapacity
+		for _, capacity := range in.CSIStorageCapacities {
+			if capacity.StorageClassName == className {
+				classCapacities = append(classCapacities, capacity)
+			}
+		}
+		scoredClassNames = append(scoredClassNames, className)
+		capacities[className] = NewClassCapacities(args, class, drivers[class.Provisioner], classCapacities)
+		classScorers[className] = scorers.Get(class)
+	}
+
+	results := make([]*NodeResult, 0, len(in.Nodes))
+	var feasible []*v1.Node
+	for _, node := range in.Nodes {
+		result := &NodeResult{Node: node.Name}
+		for _, className := range classNames {
+			_, reason, err := FindCapacity(args, node, className, claims[className], capacities, in.Assumed)
+			if err != nil {
+				return nil, err
+			}
+			if reason != nil {
+				result.Reasons = append(result.Reasons, reason)
+			}
+		}
+		if result.Feasible() {
+			feasible = append(feasible, node)
+		}
+		results = append(results, result)
+	}
+
+	scores, classScores, err := CalculateScores(args, feasible, scoredClassNames, capacities, claims, classScorers, in.Assumed)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if score, ok := scores[result.Node]; ok {
+			result.Score = &score
+			result.StorageClasses = classScores[result.Node]
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,373 @@
+package storagecapacity
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+func makeNode(name, zone string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{"topology.kubernetes.io/zone": zone},
+	}}
+}
+
+func makeClaim(name, className, size string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: v1.NamespaceDefault},
+		Spec: v1.PersistentVolumeClaimSpec{
+			StorageClassName: pointer.StringPtr(className),
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func makeCapacity(name, className, zone, size string) *CSIStorageCapacity {
+	capacity := resource.MustParse(size)
+	return NewFromV1beta1(&storagev1beta1.CSIStorageCapacity{
+		ObjectMeta:       metav1.ObjectMeta{Name: name, Namespace: v1.NamespaceDefault},
+		StorageClassName: className,
+		NodeTopology:     metav1.SetAsLabelSelector(map[string]string{"topology.kubernetes.io/zone": zone}),
+		Capacity:         &capacity,
+	})
+}
+
+func TestEvaluate(t *testing.T) {
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+	score := func(s float64) *float64 {
+		return &s
+	}
+	class := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "wait-sc"},
+		Provisioner: "wait",
+	}
+	tracked := &storagev1.CSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: "wait"},
+		Spec:       storagev1.CSIDriverSpec{StorageCapacity: pointer.BoolPtr(true)},
+	}
+	untracked := &storagev1.CSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: "wait"},
+		Spec:       storagev1.CSIDriverSpec{StorageCapacity: pointer.BoolPtr(false)},
+	}
+	nodes := []*v1.Node{
+		makeNode("zone-a-node", "zone-a"),
+		makeNode("zone-b-node", "zone-b"),
+		makeNode("zone-c-node", "zone-c"),
+	}
+	capacities := []*CSIStorageCapacity{
+		makeCapacity("csisc-1", class.Name, "zone-a", "100Gi"),
+		makeCapacity("csisc-2", class.Name, "zone-b", "40Gi"),
+		makeCapacity("csisc-3", "other-sc", "zone-c", "100Gi"),
+	}
+	claims := []*v1.PersistentVolumeClaim{makeClaim("pvc-a", class.Name, "50Gi")}
+	feasibleA := &NodeResult{
+		Node:  "zone-a-node",
+		Score: score(50),
+		StorageClasses: []*ClassScore{{
+			StorageClassName:     class.Name,
+			CSIStorageCapacities: []string{"default/csisc-1"},
+			Requested:            gi("50Gi"),
+			Capacity:             gi("100Gi"),
+			Usage:                0.5,
+			Score:                50,
+			Weight:               1,
+		}},
+	}
+	insufficientB := &NodeResult{
+		Node: "zone-b-node",
+		Reasons: []*Reason{{
+			StorageClassName: class.Name,
+			Type:             ReasonInsufficientCapacity,
+			Message:          `there is nothing enough capacities of csi storage capacity objects. node="zone-b-node" sizeInBytes=53687091200`,
+			Requested:        gi("50Gi"),
+			Available:        gi("40Gi"),
+		}},
+	}
+
+	table := []struct {
+		name   string
+		args   *config.StorageCapacityPrioritizationArgs
+		in     *Input
+		expect []*NodeResult
+	}{
+		{
+			name: "capacity is evaluated on every node",
+			args: &config.StorageCapacityPrioritizationArgs{},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes,
+				StorageClasses:       []*storagev1.StorageClass{class},
+				CSIDrivers:           []*storagev1.CSIDriver{tracked},
+				CSIStorageCapacities: capacities,
+			},
+			expect: []*NodeResult{
+				feasibleA,
+				insufficientB,
+				{
+					Node: "zone-c-node",
+					Reasons: []*Reason{{
+						StorageClassName: class.Name,
+						Type:             ReasonNodeNotCovered,
+						Message:          `there is nothing enough capacities of csi storage capacity objects. node="zone-c-node" sizeInBytes=53687091200`,
+						Requested:        gi("50Gi"),
+					}},
+				},
+			},
+		},
+		{
+			name: "unknown capacity is scored",
+			args: &config.StorageCapacityPrioritizationArgs{UnknownCapacity: config.NeutralUnknownCapacity},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes,
+				StorageClasses:       []*storagev1.StorageClass{class},
+				CSIDrivers:           []*storagev1.CSIDriver{tracked},
+				CSIStorageCapacities: capacities,
+			},
+			expect: []*NodeResult{
+				feasibleA,
+				insufficientB,
+				{
+					Node:           "zone-c-node",
+					Score:          score(50),
+					StorageClasses: []*ClassScore{{StorageClassName: class.Name, Score: 50, Weight: 1}},
+				},
+			},
+		},
+		{
+			name: "storage class of the weight 0 doesn't count",
+			args: &config.StorageCapacityPrioritizationArgs{
+				StorageClasses: []config.StorageClassPolicy{{StorageClassName: class.Name, Weight: pointer.Int32Ptr(0)}},
+			},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes[:1],
+				StorageClasses:       []*storagev1.StorageClass{class},
+				CSIDrivers:           []*storagev1.CSIDriver{tracked},
+				CSIStorageCapacities: capacities,
+			},
+			expect: []*NodeResult{
+				{
+					Node:  "zone-a-node",
+					Score: score(0),
+					StorageClasses: []*ClassScore{{
+						StorageClassName:     class.Name,
+						CSIStorageCapacities: []string{"default/csisc-1"},
+						Requested:            gi("50Gi"),
+						Capacity:             gi("100Gi"),
+						Usage:                0.5,
+						Score:                50,
+					}},
+				},
+			},
+		},
+		{
+			name: "assumed capacity is excluded",
+			args: &config.StorageCapacityPrioritizationArgs{},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes[:1],
+				StorageClasses:       []*storagev1.StorageClass{class},
+				CSIDrivers:           []*storagev1.CSIDriver{tracked},
+				CSIStorageCapacities: capacities,
+				Assumed: func(capacity *CSIStorageCapacity) int64 {
+					return gi("60Gi")
+				},
+			},
+			expect: []*NodeResult{
+				{
+					Node: "zone-a-node",
+					Reasons: []*Reason{{
+						StorageClassName: class.Name,
+						Type:             ReasonInsufficientCapacity,
+						Message:          `there is nothing enough capacities of csi storage capacity objects. node="zone-a-node" sizeInBytes=53687091200`,
+						Requested:        gi("50Gi"),
+						Available:        gi("40Gi"),
+					}},
+				},
+			},
+		},
+		{
+			name: "capacity is not tracked",
+			args: &config.StorageCapacityPrioritizationArgs{},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes[1:2],
+				StorageClasses:       []*storagev1.StorageClass{class},
+				CSIDrivers:           []*storagev1.CSIDriver{untracked},
+				CSIStorageCapacities: capacities,
+			},
+			expect: []*NodeResult{{Node: "zone-b-node"}},
+		},
+		{
+			name: "storage class is not found",
+			args: &config.StorageCapacityPrioritizationArgs{},
+			in: &Input{
+				Claims:               claims,
+				Nodes:                nodes[:1],
+				CSIDrivers:           []*storagev1.CSIDriver{tracked},
+				CSIStorageCapacities: capacities,
+			},
+			expect: []*NodeResult{
+				{
+					Node: "zone-a-node",
+					Reasons: []*Reason{{
+						StorageClassName: class.Name,
+						Type:             ReasonStorageClassNotFound,
+						Message:          `storage class "wait-sc" is not found`,
+					}},
+				},
+			},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			got, err := Evaluate(item.args, item.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, item.expect) {
+				t.Errorf("results do not match got: %+v, want: %+v", got, item.expect)
+			}
+		})
+	}
+}
+
+func TestPolicyUsable(t *testing.T) {
+	table := []struct {
+		name     string
+		policy   Policy
+		capacity int64
+		used     int64
+		expect   int64
+	}{
+		{
+			name:     "no policy",
+			capacity: 100,
+			used:     -1,
+			expect:   100,
+		},
+		{
+			name:     "larger reserve is kept",
+			policy:   Policy{Reserve: Reserve{Bytes: 20, Percentage: 10}},
+			capacity: 100,
+			used:     -1,
+			expect:   80,
+		},
+		{
+			name:     "reserve is kept before overcommit",
+			policy:   Policy{Reserve: Reserve{Percentage: 10}, Overcommit: Overcommit{Percentage: 200}},
+			capacity: 100,
+			used:     -1,
+			expect:   180,
+		},
+		{
+			name:     "used capacity below the ceiling",
+			policy:   Policy{Overcommit: Overcommit{Percentage: 300, MaxUsedPercentage: 50}},
+			capacity: 100,
+			used:     50,
+			expect:   300,
+		},
+		{
+			name:     "used capacity reaches the ceiling",
+			policy:   Policy{Overcommit: Overcommit{Percentage: 300, MaxUsedPercentage: 50}},
+			capacity: 100,
+			used:     100,
+			expect:   0,
+		},
+		{
+			name:     "unknown used capacity is not limited",
+			policy:   Policy{Overcommit: Overcommit{Percentage: 300, MaxUsedPercentage: 50}},
+			capacity: 100,
+			used:     -1,
+			expect:   300,
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			if got := item.policy.Usable(item.capacity, item.used); got != item.expect {
+				t.Errorf("usable capacity does not match got: %d, want: %d", got, item.expect)
+			}
+		})
+	}
+}
+
+func TestReserveOf(t *testing.T) {
+	reserved := resource.MustParse("10Gi")
+	args := &config.StorageCapacityPrioritizationArgs{
+		StorageClasses: []config.StorageClassPolicy{
+			{Provisioner: "wait-hdd", ReservedCapacityPercentage: 5},
+			{StorageClassName: "wait-sc", ReservedCapacity: &reserved, ReservedCapacityPercentage: 10},
+		},
+	}
+	waitSC := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "wait-sc"},
+		Provisioner: "wait",
+	}
+	waitHDDSC := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "wait-hdd-sc"},
+		Provisioner: "wait-hdd",
+	}
+	table := []struct {
+		name   string
+		class  *storagev1.StorageClass
+		expect Reserve
+	}{
+		{
+			name:   "storage class policy",
+			class:  waitSC,
+			expect: Reserve{Bytes: reserved.Value(), Percentage: 10},
+		},
+		{
+			name:   "provisioner policy",
+			class:  waitHDDSC,
+			expect: Reserve{Percentage: 5},
+		},
+		{
+			name: "annotations override the policy",
+			class: (func() *storagev1.StorageClass {
+				class := waitSC.DeepCopy()
+				class.Annotations = map[string]string{
+					ReservedCapacityAnnotation:           "1Gi",
+					ReservedCapacityPercentageAnnotation: "20",
+				}
+				return class
+			})(),
+			expect: Reserve{Bytes: 1 << 30, Percentage: 20},
+		},
+		{
+			name: "invalid annotations are ignored",
+			class: (func() *storagev1.StorageClass {
+				class := waitSC.DeepCopy()
+				class.Annotations = map[string]string{
+					ReservedCapacityAnnotation:           "-1Gi",
+					ReservedCapacityPercentageAnnotation: "120",
+				}
+				return class
+			})(),
+			expect: Reserve{Bytes: reserved.Value(), Percentage: 10},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			got := ReserveOf(args, item.class)
+			if got != item.expect {
+				t.Errorf("capacity reserve does not match got: %+v, want: %+v", got, item.expect)
+			}
+		})
+	}
+}
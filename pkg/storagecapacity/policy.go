@@ -0,0 +1,143 @@
+package storagecapacity
+
+import (
+	"strconv"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+const (
+	// ReservedCapacityAnnotation is the annotation of a StorageClass which
+	// overrides ReservedCapacity of the storage class policy.
+	ReservedCapacityAnnotation = "storage-capacity-prioritization.bells17.io/reserved-capacity"
+	// ReservedCapacityPercentageAnnotation is the annotation of a StorageClass
+	// which overrides ReservedCapacityPercentage of the storage class policy.
+	ReservedCapacityPercentageAnnotation = "storage-capacity-prioritization.bells17.io/reserved-capacity-percentage"
+)
+
+// Policy is how the capacity of every CSIStorageCapacity object of a
+// storage class is adjusted before it's compared with the claims.
+type Policy struct {
+	Reserve    Reserve
+	Overcommit Overcommit
+}
+
+// Usable returns the bytes which can be provisioned from the capacity. The
+// reserve is kept from the published capacity, and the rest is overcommitted.
+// used is the data written to the pool of the capacity, and a negative value
+// means it's unknown.
+func (p Policy) Usable(capacity, used int64) int64 {
+	if p.Overcommit.Exceeded(capacity, used) {
+		return 0
+	}
+	return p.Overcommit.Overcommitted(capacity - p.Reserve.ReservedBytes(capacity))
+}
+
+// Reserve is the capacity kept unused in every CSIStorageCapacity object of
+// a storage class.
+type Reserve struct {
+	Bytes      int64
+	Percentage int64
+}
+
+// ReservedBytes returns the bytes reserved from the capacity. The larger one
+// of the absolute amount and the percentage is reserved.
+func (r Reserve) ReservedBytes(capacity int64) int64 {
+	reserved := int64(float64(capacity) * float64(r.Percentage) / 100)
+	if r.Bytes > reserved {
+		reserved = r.Bytes
+	}
+	return reserved
+}
+
+// Overcommit is the overcommit of the capacity of every CSIStorageCapacity
+// object of a thin provisioned storage class.
+type Overcommit struct {
+	Percentage int64
+	// MaxUsedPercentage is the ceiling of the data written to the pool in
+	// percentage of the size of the pool. Zero means no ceiling.
+	MaxUsedPercentage int64
+}
+
+// Overcommitted returns the bytes which can be provisioned from the capacity.
+func (o Overcommit) Overcommitted(capacity int64) int64 {
+	if o.Percentage <= 100 || capacity <= 0 {
+		return capacity
+	}
+	return int64(float64(capacity) * float64(o.Percentage) / 100)
+}
+
+// Exceeded reports whether the data written to the pool reaches the ceiling.
+// The size of the pool is the published capacity, which is its free space,
+// and the used data. An unknown used data, given as a negative value, never
+// reaches the ceiling.
+func (o Overcommit) Exceeded(capacity, used int64) bool {
+	if o.MaxUsedPercentage <= 0 || used < 0 {
+		return false
+	}
+	return float64(used)*100 >= float64(capacity+used)*float64(o.MaxUsedPercentage)
+}
+
+// StorageClassPolicyOf returns the storage class policy of the plugin args
+// applied to the storage class. The policy matched by the storage class name
+// takes precedence over the one matched by the provisioner.
+func StorageClassPolicyOf(args *config.StorageCapacityPrioritizationArgs, class *storagev1.StorageClass) *config.StorageClassPolicy {
+	var policy *config.StorageClassPolicy
+	for i := range args.StorageClasses {
+		p := &args.StorageClasses[i]
+		if p.StorageClassName == class.Name {
+			return p
+		}
+		if policy == nil && p.Provisioner != "" && p.Provisioner == class.Provisioner {
+			policy = p
+		}
+	}
+	return policy
+}
+
+// PolicyOf returns the capacity policy of the storage class.
+func PolicyOf(args *config.StorageCapacityPrioritizationArgs, class *storagev1.StorageClass) Policy {
+	policy := Policy{
+		Reserve: ReserveOf(args, class),
+	}
+	if p := StorageClassPolicyOf(args, class); p != nil {
+		policy.Overcommit.Percentage = int64(p.OvercommitPercentage)
+		policy.Overcommit.MaxUsedPercentage = int64(p.MaxUsedCapacityPercentage)
+	}
+	return policy
+}
+
+// ReserveOf returns the capacity reserve of the storage class from the
+// storage class policy, overridden by the annotations of the storage class.
+// An invalid annotation is ignored.
+func ReserveOf(args *config.StorageCapacityPrioritizationArgs, class *storagev1.StorageClass) Reserve {
+	var reserve Reserve
+	if policy := StorageClassPolicyOf(args, class); policy != nil {
+		if policy.ReservedCapacity != nil {
+			reserve.Bytes = policy.ReservedCapacity.Value()
+		}
+		reserve.Percentage = int64(policy.ReservedCapacityPercentage)
+	}
+
+	if value, ok := class.Annotations[ReservedCapacityAnnotation]; ok {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil || quantity.Sign() < 0 {
+			klog.ErrorS(err, "Ignoring invalid reserved capacity annotation", "storageClass", klog.KObj(class), "value", value)
+		} else {
+			reserve.Bytes = quantity.Value()
+		}
+	}
+	if value, ok := class.Annotations[ReservedCapacityPercentageAnnotation]; ok {
+		percentage, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			klog.ErrorS(err, "Ignoring invalid reserved capacity percentage annotation", "storageClass", klog.KObj(class), "value", value)
+		} else {
+			reserve.Percentage = percentage
+		}
+	}
+	return reserve
+}
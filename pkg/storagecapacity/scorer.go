@@ -0,0 +1,139 @@
+package storagecapacity
+
+import (
+	"fmt"
+
+	storagev1 "k8s.io/api/storage/v1"
+	schedconfig "k8s.io/kubernetes/pkg/scheduler/apis/config"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/helper"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+const maxUtilization = 100
+
+// MaxNodeScore is the maximum score of a node, which is the same as
+// MaxNodeScore of the scheduling framework.
+const MaxNodeScore int64 = 100
+
+// Scorer computes a score of a storage class on a node from the requested
+// bytes and the capacity that is available for them. The score isn't
+// truncated so that it can be normalized across the nodes.
+type Scorer func(requested, capacity int64) float64
+
+// Usage returns the ratio of requested to capacity capped to 1.
+func Usage(requested, capacity int64) float64 {
+	if capacity <= 0 {
+		return 1
+	}
+	u := float64(requested) / float64(capacity)
+	if u > 1 {
+		u = 1
+	}
+	return u
+}
+
+func mostAllocatedScorer(requested, capacity int64) float64 {
+	return Usage(requested, capacity) * float64(MaxNodeScore)
+}
+
+func leastAllocatedScorer(requested, capacity int64) float64 {
+	return (1 - Usage(requested, capacity)) * float64(MaxNodeScore)
+}
+
+func requestedToCapacityRatioScorer(shape []config.UtilizationShapePoint) Scorer {
+	shapes := make([]helper.FunctionShapePoint, 0, len(shape))
+	for _, point := range shape {
+		shapes = append(shapes, helper.FunctionShapePoint{
+			Utilization: int64(point.Utilization),
+			// MaxCustomPriorityScore may diverge from the max score used in the scheduler and defined by MaxNodeScore,
+			// therefore we need to scale the score returned by requested to capacity ratio to the score range
+			// used by the scheduler.
+			Score: int64(point.Score) * (MaxNodeScore / schedconfig.MaxCustomPriorityScore),
+		})
+	}
+	rawScoringFunction := helper.BuildBrokenLinearFunction(shapes)
+	return func(requested, capacity int64) float64 {
+		if capacity <= 0 || requested > capacity {
+			return float64(rawScoringFunction(maxUtilization))
+		}
+		return float64(rawScoringFunction(requested * maxUtilization / capacity))
+	}
+}
+
+// NewScorer returns the scorer of the scoring strategy.
+// MostAllocated is used when the strategy is nil.
+func NewScorer(strategy *config.ScoringStrategy) (Scorer, error) {
+	if strategy == nil {
+		return mostAllocatedScorer, nil
+	}
+	switch strategy.Type {
+	case config.MostAllocated, "":
+		return mostAllocatedScorer, nil
+	case config.LeastAllocated:
+		return leastAllocatedScorer, nil
+	case config.RequestedToCapacityRatio:
+		if strategy.RequestedToCapacityRatio == nil {
+			return nil, fmt.Errorf("requestedToCapacityRatio is required for scoring strategy %q", strategy.Type)
+		}
+		return requestedToCapacityRatioScorer(strategy.RequestedToCapacityRatio.Shape), nil
+	}
+	return nil, fmt.Errorf("scoring strategy %q is not supported", strategy.Type)
+}
+
+// ClassScorer is the scorer and the weight applied to a storage class.
+type ClassScorer struct {
+	Scorer Scorer
+	Weight int64
+}
+
+// ClassScorers resolves the ClassScorer of a storage class from the
+// StorageClasses of the plugin args.
+type ClassScorers struct {
+	defaultScorer ClassScorer
+	byClassName   map[string]ClassScorer
+	byProvisioner map[string]ClassScorer
+}
+
+// NewClassScorers returns the ClassScorers of the plugin args.
+func NewClassScorers(args *config.StorageCapacityPrioritizationArgs) (*ClassScorers, error) {
+	defaultScorer, err := NewScorer(args.ScoringStrategy)
+	if err != nil {
+		return nil, err
+	}
+	scs := &ClassScorers{
+		defaultScorer: ClassScorer{Scorer: defaultScorer, Weight: 1},
+		byClassName:   map[string]ClassScorer{},
+		byProvisioner: map[string]ClassScorer{},
+	}
+	for _, policy := range args.StorageClasses {
+		s := scs.defaultScorer
+		if policy.ScoringStrategy != nil {
+			s.Scorer, err = NewScorer(policy.ScoringStrategy)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if policy.Weight != nil {
+			s.Weight = int64(*policy.Weight)
+		}
+		if policy.StorageClassName != "" {
+			scs.byClassName[policy.StorageClassName] = s
+		} else {
+			scs.byProvisioner[policy.Provisioner] = s
+		}
+	}
+	return scs, nil
+}
+
+// Get returns the ClassScorer of the storage class. The policy matched by the
+// storage class name takes precedence over the one matched by the provisioner.
+func (scs *ClassScorers) Get(class *storagev1.StorageClass) ClassScorer {
+	if s, ok := scs.byClassName[class.Name]; ok {
+		return s
+	}
+	if s, ok := scs.byProvisioner[class.Provisioner]; ok {
+		return s
+	}
+	return scs.defaultScorer
+}
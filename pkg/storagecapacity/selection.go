@@ -0,0 +1,242 @@
+package storagecapacity
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+// AssumedFunc returns the bytes of the capacity which are consumed by the
+// claims of the reserved pods but are not reflected in the object yet.
+// A nil AssumedFunc assumes nothing.
+type AssumedFunc func(capacity *CSIStorageCapacity) int64
+
+// Available returns the capacity of the CSIStorageCapacity object adjusted by
+// the policy, excluding the capacity assumed by the reserved pods.
+func Available(capacity *CSIStorageCapacity, policy Policy, assumed AssumedFunc) int64 {
+	available := policy.Usable(capacity.Capacity.Value(), capacity.UsedBytes())
+	if assumed != nil {
+		available -= assumed(capacity)
+	}
+	return available
+}
+
+// Allocation is the bytes of a claim group which are going to be
+// provisioned from a CSIStorageCapacity object.
+type Allocation struct {
+	Capacity *CSIStorageCapacity
+	Bytes    int64
+}
+
+// Selection is the capacity of a storage class selected for a node from the
+// CSIStorageCapacity objects which match the node.
+type Selection struct {
+	// Available is the capacity available to the claim group.
+	Available int64
+	// Sufficient reports whether Available is enough for the claim group.
+	Sufficient bool
+	// Allocations are the CSIStorageCapacity objects the claim group is
+	// provisioned from. It's empty when the capacity is not sufficient.
+	Allocations []Allocation
+	// MaximumVolumeSize is the largest volume which can be provisioned from
+	// the selected capacity. 0 means it's not limited.
+	MaximumVolumeSize int64
+	// ExceedsMaximumVolumeSize reports whether the largest claim of the claim
+	// group is larger than the MaximumVolumeSize of all the matching objects.
+	ExceedsMaximumVolumeSize bool
+}
+
+// Select aggregates the CSIStorageCapacity objects of the storage class
+// which the node has access to, according to the aggregation.
+// Only the objects whose MaximumVolumeSize allows largestClaim are selected,
+// and Sum adds up only those objects. Pack is handled by Pack.
+// The capacity of every object is adjusted by the policy.
+// It returns nil when no CSIStorageCapacity object matches the node.
+func Select(aggregation config.CapacityAggregationType, node *v1.Node, className string, capacities []*CSIStorageCapacity, sizeInBytes, largestClaim int64, policy Policy, assumed AssumedFunc) *Selection {
+	matched, available := matchingCapacities(node, className, capacities, policy, assumed)
+	if len(matched) == 0 {
+		return nil
+	}
+
+	var fitting []*CSIStorageCapacity
+	for _, capacity := range matched {
+		if capacity.MaximumVolumeSize == nil || capacity.MaximumVolumeSize.Value() >= largestClaim {
+			fitting = append(fitting, capacity)
+		}
+	}
+	if len(fitting) == 0 {
+		return &Selection{
+			Available:                available[matched[0]],
+			ExceedsMaximumVolumeSize: true,
+		}
+	}
+
+	switch aggregation {
+	case config.SumCapacityAggregation:
+		selection := &Selection{}
+		for _, capacity := range fitting {
+			if available[capacity] > 0 {
+				selection.Available += available[capacity]
+			}
+		}
+		for _, capacity := range fitting {
+			if capacity.MaximumVolumeSize == nil {
+				selection.MaximumVolumeSize = 0
+				break
+			}
+			if capacity.MaximumVolumeSize.Value() > selection.MaximumVolumeSize {
+				selection.MaximumVolumeSize = capacity.MaximumVolumeSize.Value()
+			}
+		}
+		if selection.Available < sizeInBytes {
+			return selection
+		}
+		selection.Sufficient = true
+		remaining := sizeInBytes
+		for _, capacity := range fitting {
+			if remaining <= 0 {
+				break
+			}
+			bytes := available[capacity]
+			if bytes <= 0 {
+				continue
+			}
+			if bytes > remaining {
+				bytes = remaining
+			}
+			selection.Allocations = append(selection.Allocations, Allocation{Capacity: capacity, Bytes: bytes})
+			remaining -= bytes
+		}
+		return selection
+	case config.BestFitCapacityAggregation:
+		for i := len(fitting) - 1; i >= 0; i-- {
+			if available[fitting[i]] >= sizeInBytes {
+				return newSingleSelection(fitting[i], available[fitting[i]], sizeInBytes)
+			}
+		}
+	}
+	// Max is used by default, and by BestFit when no object is sufficient.
+	return newSingleSelection(fitting[0], available[fitting[0]], sizeInBytes)
+}
+
+// Pack packs the claims into the CSIStorageCapacity objects of the storage
+// class which the node has access to, in first-fit decreasing order: from the
+// largest claim, every claim is placed in the first object, ordered by the
+// available capacity, which has enough capacity left and whose
+// MaximumVolumeSize allows the claim. The capacity is sufficient when all the
+// claims are placed, and the available capacity is the sum of the objects so
+// that the claims are scored by the utilization of the node after placement.
+// It returns nil when no CSIStorageCapacity object matches the node.
+func Pack(node *v1.Node, className string, capacities []*CSIStorageCapacity, claimSizes []int64, policy Policy, assumed AssumedFunc) *Selection {
+	matched, available := matchingCapacities(node, className, capacities, policy, assumed)
+	if len(matched) == 0 {
+		return nil
+	}
+
+	selection := &Selection{}
+	unlimited := false
+	for _, capacity := range matched {
+		if available[capacity] > 0 {
+			selection.Available += available[capacity]
+		}
+		if capacity.MaximumVolumeSize == nil {
+			unlimited = true
+		} else if capacity.MaximumVolumeSize.Value() > selection.MaximumVolumeSize {
+			selection.MaximumVolumeSize = capacity.MaximumVolumeSize.Value()
+		}
+	}
+	if unlimited {
+		selection.MaximumVolumeSize = 0
+	}
+
+	sizes := append([]int64{}, claimSizes...)
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i] > sizes[j]
+	})
+	if selection.MaximumVolumeSize > 0 && len(sizes) > 0 && sizes[0] > selection.MaximumVolumeSize {
+		return &Selection{
+			Available:                available[matched[0]],
+			ExceedsMaximumVolumeSize: true,
+		}
+	}
+
+	remaining := map[*CSIStorageCapacity]int64{}
+	for _, capacity := range matched {
+		remaining[capacity] = available[capacity]
+	}
+	for _, size := range sizes {
+		placed := false
+		for _, capacity := range matched {
+			if remaining[capacity] < size || (capacity.MaximumVolumeSize != nil && capacity.MaximumVolumeSize.Value() < size) {
+				continue
+			}
+			remaining[capacity] -= size
+			placed = true
+			break
+		}
+		if !placed {
+			return selection
+		}
+	}
+	selection.Sufficient = true
+	for _, capacity := range matched {
+		if bytes := available[capacity] - remaining[capacity]; bytes > 0 {
+			selection.Allocations = append(selection.Allocations, Allocation{Capacity: capacity, Bytes: bytes})
+		}
+	}
+	return selection
+}
+
+// matchingCapacities returns the CSIStorageCapacity objects of the storage
+// class which the node has access to, and their available capacity. The
+// objects are sorted by the available capacity in descending order, and by
+// the name so that the selection is stable.
+func matchingCapacities(node *v1.Node, className string, capacities []*CSIStorageCapacity, policy Policy, assumed AssumedFunc) ([]*CSIStorageCapacity, map[*CSIStorageCapacity]int64) {
+	var matched []*CSIStorageCapacity
+	available := map[*CSIStorageCapacity]int64{}
+	for _, capacity := range capacities {
+		if capacity.StorageClassName != className || capacity.Capacity == nil || !NodeHasAccess(node, capacity) {
+			continue
+		}
+		matched = append(matched, capacity)
+		available[capacity] = Available(capacity, policy, assumed)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if available[matched[i]] != available[matched[j]] {
+			return available[matched[i]] > available[matched[j]]
+		}
+		if matched[i].Namespace != matched[j].Namespace {
+			return matched[i].Namespace < matched[j].Namespace
+		}
+		return matched[i].Name < matched[j].Name
+	})
+	return matched, available
+}
+
+func newSingleSelection(capacity *CSIStorageCapacity, available, sizeInBytes int64) *Selection {
+	selection := &Selection{Available: available}
+	if capacity.MaximumVolumeSize != nil {
+		selection.MaximumVolumeSize = capacity.MaximumVolumeSize.Value()
+	}
+	if available >= sizeInBytes {
+		selection.Sufficient = true
+		selection.Allocations = []Allocation{{Capacity: capacity, Bytes: sizeInBytes}}
+	}
+	return selection
+}
+
+// UsageOf returns the requested bytes and the capacity which the scorer is
+// applied to. When considerMaximumVolumeSize is set, the ratio of the largest
+// claim to the maximum volume size is used if it's higher than the ratio of
+// the requested bytes to the available capacity.
+func (s *Selection) UsageOf(requested, largestClaim int64, considerMaximumVolumeSize bool) (int64, int64) {
+	if !considerMaximumVolumeSize || s.MaximumVolumeSize <= 0 || s.Available <= 0 {
+		return requested, s.Available
+	}
+	if Usage(largestClaim, s.MaximumVolumeSize) > Usage(requested, s.Available) {
+		return largestClaim, s.MaximumVolumeSize
+	}
+	return requested, s.Available
+}
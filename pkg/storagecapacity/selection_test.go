@@ -0,0 +1,337 @@
+package storagecapacity
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/bells17/storage-capacity-prioritization-scheduler/pkg/apis/config"
+)
+
+func withMaximumVolumeSize(capacity *CSIStorageCapacity, size string) *CSIStorageCapacity {
+	q := resource.MustParse(size)
+	capacity.MaximumVolumeSize = &q
+	return capacity
+}
+
+func withUsedCapacity(capacity *CSIStorageCapacity, size string) *CSIStorageCapacity {
+	capacity.Annotations = map[string]string{UsedCapacityAnnotation: size}
+	capacity.parseUsedBytes()
+	return capacity
+}
+
+func TestSelect(t *testing.T) {
+	node := makeNode("zone-a-node", "zone-a")
+	small := makeCapacity("csisc-1", "wait-sc", "zone-a", "40Gi")
+	large := makeCapacity("csisc-2", "wait-sc", "zone-a", "60Gi")
+	otherZone := makeCapacity("csisc-3", "wait-sc", "zone-b", "100Gi")
+	otherClass := makeCapacity("csisc-4", "other-sc", "zone-a", "100Gi")
+	limited := withMaximumVolumeSize(makeCapacity("csisc-5", "wait-sc", "zone-a", "80Gi"), "10Gi")
+	capacities := []*CSIStorageCapacity{small, large, otherZone, otherClass}
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+
+	table := []struct {
+		name         string
+		aggregation  config.CapacityAggregationType
+		capacities   []*CSIStorageCapacity
+		sizeInBytes  int64
+		largestClaim int64
+		policy       Policy
+		expect       *Selection
+	}{
+		{
+			name:        "no matching capacity",
+			capacities:  []*CSIStorageCapacity{otherZone, otherClass},
+			sizeInBytes: gi("20Gi"),
+			expect:      nil,
+		},
+		{
+			name:        "Max by default",
+			capacities:  capacities,
+			sizeInBytes: gi("20Gi"),
+			expect: &Selection{
+				Available:   gi("60Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: large, Bytes: gi("20Gi")}},
+			},
+		},
+		{
+			name:        "Max is not sufficient",
+			aggregation: config.MaxCapacityAggregation,
+			capacities:  capacities,
+			sizeInBytes: gi("80Gi"),
+			expect: &Selection{
+				Available: gi("60Gi"),
+			},
+		},
+		{
+			name:        "Sum",
+			aggregation: config.SumCapacityAggregation,
+			capacities:  capacities,
+			sizeInBytes: gi("80Gi"),
+			expect: &Selection{
+				Available:  gi("100Gi"),
+				Sufficient: true,
+				Allocations: []Allocation{
+					{Capacity: large, Bytes: gi("60Gi")},
+					{Capacity: small, Bytes: gi("20Gi")},
+				},
+			},
+		},
+		{
+			name:         "Sum skips the capacity whose MaximumVolumeSize is exceeded",
+			aggregation:  config.SumCapacityAggregation,
+			capacities:   []*CSIStorageCapacity{small, large, limited},
+			sizeInBytes:  gi("120Gi"),
+			largestClaim: gi("20Gi"),
+			expect: &Selection{
+				Available: gi("100Gi"),
+			},
+		},
+		{
+			name:        "BestFit",
+			aggregation: config.BestFitCapacityAggregation,
+			capacities:  capacities,
+			sizeInBytes: gi("20Gi"),
+			expect: &Selection{
+				Available:   gi("40Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: small, Bytes: gi("20Gi")}},
+			},
+		},
+		{
+			name:        "BestFit skips not sufficient capacity",
+			aggregation: config.BestFitCapacityAggregation,
+			capacities:  capacities,
+			sizeInBytes: gi("50Gi"),
+			expect: &Selection{
+				Available:   gi("60Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: large, Bytes: gi("50Gi")}},
+			},
+		},
+		{
+			name:         "MaximumVolumeSize excludes capacity",
+			capacities:   []*CSIStorageCapacity{small, limited},
+			sizeInBytes:  gi("20Gi"),
+			largestClaim: gi("20Gi"),
+			expect: &Selection{
+				Available:   gi("40Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: small, Bytes: gi("20Gi")}},
+			},
+		},
+		{
+			name:         "MaximumVolumeSize is exceeded",
+			capacities:   []*CSIStorageCapacity{limited},
+			sizeInBytes:  gi("20Gi"),
+			largestClaim: gi("20Gi"),
+			expect: &Selection{
+				Available:                gi("80Gi"),
+				ExceedsMaximumVolumeSize: true,
+			},
+		},
+		{
+			name:         "MaximumVolumeSize of the selected capacity",
+			capacities:   []*CSIStorageCapacity{limited},
+			sizeInBytes:  gi("20Gi"),
+			largestClaim: gi("10Gi"),
+			expect: &Selection{
+				Available:         gi("80Gi"),
+				Sufficient:        true,
+				Allocations:       []Allocation{{Capacity: limited, Bytes: gi("20Gi")}},
+				MaximumVolumeSize: gi("10Gi"),
+			},
+		},
+		{
+			name:        "reserved percentage makes capacity insufficient",
+			capacities:  capacities,
+			sizeInBytes: gi("50Gi"),
+			policy:      Policy{Reserve: Reserve{Percentage: 20}},
+			expect: &Selection{
+				Available: gi("48Gi"),
+			},
+		},
+		{
+			name:        "larger reserve is used",
+			capacities:  capacities,
+			sizeInBytes: gi("20Gi"),
+			policy:      Policy{Reserve: Reserve{Bytes: gi("15Gi"), Percentage: 10}},
+			expect: &Selection{
+				Available:   gi("45Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: large, Bytes: gi("20Gi")}},
+			},
+		},
+		{
+			name:        "overcommit",
+			capacities:  capacities,
+			sizeInBytes: gi("100Gi"),
+			policy:      Policy{Overcommit: Overcommit{Percentage: 200}},
+			expect: &Selection{
+				Available:   gi("120Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: large, Bytes: gi("100Gi")}},
+			},
+		},
+		{
+			name: "overcommit stops at the used capacity ceiling",
+			capacities: []*CSIStorageCapacity{
+				withUsedCapacity(makeCapacity("csisc-1", "wait-sc", "zone-a", "40Gi"), "20Gi"),
+				withUsedCapacity(makeCapacity("csisc-2", "wait-sc", "zone-a", "60Gi"), "90Gi"),
+			},
+			sizeInBytes: gi("100Gi"),
+			policy:      Policy{Overcommit: Overcommit{Percentage: 200, MaxUsedPercentage: 50}},
+			expect: &Selection{
+				Available: gi("80Gi"),
+			},
+		},
+		{
+			name:        "reserve is kept before overcommit",
+			capacities:  capacities,
+			sizeInBytes: gi("100Gi"),
+			policy: Policy{
+				Reserve:    Reserve{Bytes: gi("10Gi")},
+				Overcommit: Overcommit{Percentage: 200},
+			},
+			expect: &Selection{
+				Available:   gi("100Gi"),
+				Sufficient:  true,
+				Allocations: []Allocation{{Capacity: large, Bytes: gi("100Gi")}},
+			},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			got := Select(item.aggregation, node, "wait-sc", item.capacities, item.sizeInBytes, item.largestClaim, item.policy, nil)
+			if !reflect.DeepEqual(got, item.expect) {
+				t.Errorf("capacity selection does not match got: %+v, want: %+v", got, item.expect)
+			}
+		})
+	}
+}
+
+func TestPack(t *testing.T) {
+	node := makeNode("zone-a-node", "zone-a")
+	small := makeCapacity("csisc-1", "wait-sc", "zone-a", "40Gi")
+	large := makeCapacity("csisc-2", "wait-sc", "zone-a", "60Gi")
+	otherZone := makeCapacity("csisc-3", "wait-sc", "zone-b", "100Gi")
+	limited := withMaximumVolumeSize(makeCapacity("csisc-5", "wait-sc", "zone-a", "80Gi"), "10Gi")
+	gi := func(s string) int64 {
+		q := resource.MustParse(s)
+		return q.Value()
+	}
+
+	table := []struct {
+		name       string
+		capacities []*CSIStorageCapacity
+		claimSizes []int64
+		expect     *Selection
+	}{
+		{
+			name:       "no matching capacity",
+			capacities: []*CSIStorageCapacity{otherZone},
+			claimSizes: []int64{gi("20Gi")},
+			expect:     nil,
+		},
+		{
+			name:       "claims are spread over the objects",
+			capacities: []*CSIStorageCapacity{small, large, otherZone},
+			claimSizes: []int64{gi("30Gi"), gi("30Gi"), gi("30Gi")},
+			expect: &Selection{
+				Available:  gi("100Gi"),
+				Sufficient: true,
+				Allocations: []Allocation{
+					{Capacity: large, Bytes: gi("60Gi")},
+					{Capacity: small, Bytes: gi("30Gi")},
+				},
+			},
+		},
+		{
+			name:       "claims don't fit though the sum is enough",
+			capacities: []*CSIStorageCapacity{small, large},
+			claimSizes: []int64{gi("50Gi"), gi("50Gi")},
+			expect: &Selection{
+				Available: gi("100Gi"),
+			},
+		},
+		{
+			name:       "claims are placed within the maximum volume size",
+			capacities: []*CSIStorageCapacity{limited, small},
+			claimSizes: []int64{gi("5Gi"), gi("20Gi")},
+			expect: &Selection{
+				Available:  gi("120Gi"),
+				Sufficient: true,
+				Allocations: []Allocation{
+					{Capacity: limited, Bytes: gi("5Gi")},
+					{Capacity: small, Bytes: gi("20Gi")},
+				},
+			},
+		},
+		{
+			name:       "claim exceeds the maximum volume size",
+			capacities: []*CSIStorageCapacity{limited},
+			claimSizes: []int64{gi("20Gi")},
+			expect: &Selection{
+				Available:                gi("80Gi"),
+				ExceedsMaximumVolumeSize: true,
+			},
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			got := Pack(node, "wait-sc", item.capacities, item.claimSizes, Policy{}, nil)
+			if !reflect.DeepEqual(got, item.expect) {
+				t.Errorf("capacity selection does not match got: %+v, want: %+v", got, item.expect)
+			}
+		})
+	}
+}
+
+func TestSelectionUsageOf(t *testing.T) {
+	selection := &Selection{Available: 100, MaximumVolumeSize: 20}
+	table := []struct {
+		name                      string
+		requested                 int64
+		largestClaim              int64
+		considerMaximumVolumeSize bool
+		expectRequested           int64
+		expectCapacity            int64
+	}{
+		{
+			name:            "not considered",
+			requested:       30,
+			largestClaim:    15,
+			expectRequested: 30,
+			expectCapacity:  100,
+		},
+		{
+			name:                      "largest claim ratio is higher",
+			requested:                 30,
+			largestClaim:              15,
+			considerMaximumVolumeSize: true,
+			expectRequested:           15,
+			expectCapacity:            20,
+		},
+		{
+			name:                      "requested ratio is higher",
+			requested:                 90,
+			largestClaim:              10,
+			considerMaximumVolumeSize: true,
+			expectRequested:           90,
+			expectCapacity:            100,
+		},
+	}
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			requested, capacity := selection.UsageOf(item.requested, item.largestClaim, item.considerMaximumVolumeSize)
+			if requested != item.expectRequested || capacity != item.expectCapacity {
+				t.Errorf("usage does not match got: %d/%d, want: %d/%d", requested, capacity, item.expectRequested, item.expectCapacity)
+			}
+		})
+	}
+}